@@ -0,0 +1,124 @@
+package ftpserver
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// AccessRule ...
+type AccessRule struct {
+	Allow bool
+	Net   *net.IPNet
+}
+
+func (rule AccessRule) String() string {
+	if rule.Allow {
+		return "allow " + rule.Net.String()
+	}
+	return "deny " + rule.Net.String()
+}
+
+// AccessList holds allow and deny rules, a deny rule always wins and when
+// there is any allow rule an address must match one of them.
+type AccessList struct {
+	rules []AccessRule
+}
+
+// ParseCIDR accepts a CIDR or a single IP address
+func ParseCIDR(cidr string) (*net.IPNet, error) {
+	if !strings.Contains(cidr, "/") {
+		ip := net.ParseIP(cidr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address %q", cidr)
+		}
+		if ip.To4() != nil {
+			return &(net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)}), nil
+		}
+		return &(net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}), nil
+	}
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	return ipNet, nil
+}
+
+// Add appends a rule for every comma separated CIDR
+func (accessList *AccessList) Add(allow bool, cidrs string) error {
+	for _, cidr := range strings.Split(cidrs, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		ipNet, err := ParseCIDR(cidr)
+		if err != nil {
+			return err
+		}
+		accessList.rules = append(accessList.rules, AccessRule{allow, ipNet})
+	}
+	return nil
+}
+
+// Empty ...
+func (accessList *AccessList) Empty() bool {
+	return accessList == nil || len(accessList.rules) == 0
+}
+
+// Check tells whether ip may connect and which rule decided it
+func (accessList *AccessList) Check(ip string) (bool, string) {
+	if accessList.Empty() {
+		return true, ""
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false, "invalid address " + ip
+	}
+	hasAllow := false
+	for _, rule := range accessList.rules {
+		if !rule.Allow && rule.Net.Contains(addr) {
+			return false, rule.String()
+		}
+		hasAllow = hasAllow || rule.Allow
+	}
+	if !hasAllow {
+		return true, ""
+	}
+	for _, rule := range accessList.rules {
+		if rule.Allow && rule.Net.Contains(addr) {
+			return true, rule.String()
+		}
+	}
+	return false, "no allow rule matched"
+}
+
+// CreateAccessListFromFile reads lines of "allow <cidr>" or "deny <cidr>",
+// a missing file gives an empty list.
+func CreateAccessListFromFile(accessFile string) (*AccessList, error) {
+	accessList := &(AccessList{})
+	file, err := os.Open(accessFile)
+	if os.IsNotExist(err) {
+		return accessList, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		strs := strings.Fields(scanner.Text())
+		if len(strs) == 0 || strings.HasPrefix(strs[0], "#") {
+			continue
+		}
+		if len(strs) != 2 || (strs[0] != "allow" && strs[0] != "deny") {
+			return nil, fmt.Errorf("%v:%v: expected \"allow <cidr>\" or \"deny <cidr>\"", accessFile, lineNo)
+		}
+		err = accessList.Add(strs[0] == "allow", strs[1])
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", accessFile, lineNo, err)
+		}
+	}
+	return accessList, scanner.Err()
+}
@@ -0,0 +1,131 @@
+package ftpserver
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestAccessListCheck(t *testing.T) {
+	tests := []struct {
+		allow   string
+		deny    string
+		ip      string
+		allowed bool
+		rule    string
+	}{
+		{"", "", "192.0.2.7", true, ""},
+		{"10.0.0.0/8", "", "10.1.2.3", true, "allow 10.0.0.0/8"},
+		{"10.0.0.0/8", "", "192.0.2.7", false, "no allow rule matched"},
+		{"10.0.0.0/8,192.168.0.0/16", "", "192.168.1.1", true, "allow 192.168.0.0/16"},
+		{"", "192.0.2.0/24", "192.0.2.7", false, "deny 192.0.2.0/24"},
+		{"", "192.0.2.0/24", "198.51.100.1", true, ""},
+		{"10.0.0.0/8", "10.9.0.0/16", "10.9.1.1", false, "deny 10.9.0.0/16"},
+		{"10.0.0.0/8", "10.9.0.0/16", "10.8.1.1", true, "allow 10.0.0.0/8"},
+		{"192.0.2.7", "", "192.0.2.7", true, "allow 192.0.2.7/32"},
+		{"192.0.2.7", "", "192.0.2.8", false, "no allow rule matched"},
+		{"2001:db8::/32", "", "2001:db8::1", true, "allow 2001:db8::/32"},
+		{"2001:db8::1", "", "2001:db8::2", false, "no allow rule matched"},
+		{"10.0.0.0/8", "", "not-an-ip", false, "invalid address not-an-ip"},
+	}
+	for _, test := range tests {
+		accessList := &(AccessList{})
+		if err := accessList.Add(true, test.allow); err != nil {
+			t.Fatalf("Add(allow, %q): %v", test.allow, err)
+		}
+		if err := accessList.Add(false, test.deny); err != nil {
+			t.Fatalf("Add(deny, %q): %v", test.deny, err)
+		}
+		allowed, rule := accessList.Check(test.ip)
+		if allowed != test.allowed || rule != test.rule {
+			t.Errorf("allow %q deny %q: Check(%v) = %v, %q, want %v, %q", test.allow, test.deny, test.ip,
+				allowed, rule, test.allowed, test.rule)
+		}
+	}
+}
+
+func TestAccessListAddInvalid(t *testing.T) {
+	for _, cidr := range []string{"10.0.0.0/33", "10.0.0", "host.example.com", "10.0.0.0/8,nope"} {
+		if err := (&(AccessList{})).Add(true, cidr); err == nil {
+			t.Errorf("Add(%q) accepted an invalid CIDR", cidr)
+		}
+	}
+}
+
+// writeTempFile writes content to a temporary file and returns its name
+func writeTempFile(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "myftp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err = file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
+
+func TestCreateAccessListFromFile(t *testing.T) {
+	name := writeTempFile(t, "# office\nallow 10.0.0.0/8\n\ndeny 10.9.0.0/16\n")
+	defer os.Remove(name)
+	accessList, err := CreateAccessListFromFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowed, _ := accessList.Check("10.9.0.1"); allowed {
+		t.Errorf("10.9.0.1 allowed despite the deny line")
+	}
+	if allowed, _ := accessList.Check("10.1.0.1"); !allowed {
+		t.Errorf("10.1.0.1 denied despite the allow line")
+	}
+
+	accessList, err = CreateAccessListFromFile(name + ".missing")
+	if err != nil || !accessList.Empty() {
+		t.Errorf("missing file = %v, %v, want an empty list", accessList, err)
+	}
+
+	for _, content := range []string{"permit 10.0.0.0/8\n", "allow\n", "deny 10.0.0.0/99\n"} {
+		bad := writeTempFile(t, content)
+		if _, err = CreateAccessListFromFile(bad); err == nil {
+			t.Errorf("%q accepted", content)
+		}
+		os.Remove(bad)
+	}
+}
+
+func TestAccountAccess(t *testing.T) {
+	name := writeTempFile(t, "# service accounts\nsvc secret /svc allow=10.0.0.0/8 fxp=yes\nABC 12345678 /ABC\n")
+	defer os.Remove(name)
+	accounts, err := CreateAccountListFromFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := Authenticate("svc", "secret", accounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowed, _ := account.Access.Check("192.0.2.7"); allowed {
+		t.Errorf("svc may log in from outside 10.0.0.0/8")
+	}
+	if allowed, _ := account.Access.Check("10.0.0.7"); !allowed {
+		t.Errorf("svc may not log in from 10.0.0.7")
+	}
+	if account.Options["fxp"] != "yes" {
+		t.Errorf("options = %v, want fxp=yes", account.Options)
+	}
+	account, err = Authenticate("ABC", "12345678", accounts)
+	if err != nil || !account.Access.Empty() {
+		t.Errorf("ABC = %v, %v, want no access rules", account, err)
+	}
+	if _, err = Authenticate("ABC", "wrong", accounts); err == nil {
+		t.Errorf("wrong password accepted")
+	}
+
+	for _, content := range []string{"ABC 12345678\n", "ABC 12345678 /ABC allow\n", "ABC 12345678 /ABC deny=10.0.0\n"} {
+		bad := writeTempFile(t, content)
+		if _, err = CreateAccountListFromFile(bad); err == nil {
+			t.Errorf("%q accepted", content)
+		}
+		os.Remove(bad)
+	}
+}
@@ -0,0 +1,153 @@
+package ftpserver
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// FtpAdmin serves the administration HTTP API of a FTP server, every
+// request must carry the token in an "Authorization: Bearer" header
+type FtpAdmin struct {
+	server     *FtpServer
+	token      string
+	httpServer *http.Server
+}
+
+// CreateFtpAdmin ...
+func CreateFtpAdmin(addr string, token string, server *FtpServer) *FtpAdmin {
+	admin := &(FtpAdmin{server, token, nil})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bans", admin.handleBans)
+	mux.HandleFunc("/reload", admin.handleReload)
+	mux.HandleFunc("/loglevel", admin.handleLogLevel)
+	mux.HandleFunc("/sessions", admin.handleSessions)
+	mux.HandleFunc("/broadcast", admin.handleBroadcast)
+	admin.httpServer = &(http.Server{Addr: addr, Handler: admin.authenticate(mux)})
+	return admin
+}
+
+// authenticate rejects requests without the admin token
+func (admin *FtpAdmin) authenticate(next http.Handler) http.Handler {
+	expected := []byte("Bearer " + admin.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if admin.token == "" || subtle.ConstantTimeCompare(got, expected) != 1 {
+			admin.server.logger.Warn("admin request rejected", F("path", r.URL.Path), F("remote", r.RemoteAddr))
+			w.Header().Set("WWW-Authenticate", `Bearer realm="myftp"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ListenAndServe ...
+func (admin *FtpAdmin) ListenAndServe() error {
+	admin.server.logger.Info("admin API listening", F("addr", admin.httpServer.Addr))
+	return admin.httpServer.ListenAndServe()
+}
+
+// handleBans lists bans on GET and lifts the ban of ?ip= on DELETE
+func (admin *FtpAdmin) handleBans(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, admin.server.bans.List())
+	case http.MethodDelete:
+		ip := r.URL.Query().Get("ip")
+		if ip == "" {
+			http.Error(w, "missing ip parameter", http.StatusBadRequest)
+			return
+		}
+		if !admin.server.bans.Lift(ip) {
+			http.Error(w, "ip not banned", http.StatusNotFound)
+			return
+		}
+		admin.server.logger.Info("ban lifted", F("ip", ip), F("by", r.RemoteAddr))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleReload reloads the access rules on POST
+func (admin *FtpAdmin) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	err := admin.server.Reload()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSessions lists the sessions on GET and kicks the session ?id= on
+// DELETE
+func (admin *FtpAdmin) handleSessions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, admin.server.Sessions())
+	case http.MethodDelete:
+		id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "missing or invalid id parameter", http.StatusBadRequest)
+			return
+		}
+		if !admin.server.Kick(id) {
+			http.Error(w, "no such session", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleBroadcast queues {"message": "..."} for every session on POST, it
+// is sent before their next reply
+func (admin *FtpAdmin) handleBroadcast(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		Message string `json:"message"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.Message == "" {
+		http.Error(w, "expected {\"message\": \"...\"}", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"sessions": admin.server.Broadcast(body.Message)})
+}
+
+// handleLogLevel returns the log level on GET and sets it to ?level= on PUT
+func (admin *FtpAdmin) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	logger := admin.server.logger
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]string{"level": logger.Level().String()})
+	case http.MethodPut:
+		level, err := ParseLogLevel(r.URL.Query().Get("level"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		old := logger.Level()
+		logger.SetLevel(level)
+		logger.Warn("log level changed", F("from", old), F("to", level), F("by", r.RemoteAddr))
+		writeJSON(w, http.StatusOK, map[string]string{"level": level.String()})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,186 @@
+package ftpserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// adminRequest sends a request with the token "secret" to the admin API
+func adminRequest(admin *FtpAdmin, method string, target string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer secret")
+	recorder := httptest.NewRecorder()
+	admin.httpServer.Handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAdminAuthenticate(t *testing.T) {
+	for _, test := range []struct {
+		token  string
+		header string
+		code   int
+	}{
+		{"secret", "Bearer secret", 200},
+		{"secret", "Bearer wrong", 401},
+		{"secret", "secret", 401},
+		{"secret", "", 401},
+		{"", "Bearer ", 401},
+	} {
+		ftpServer, _, cleanup := startTestServer(t, nil)
+		admin := CreateFtpAdmin("127.0.0.1:0", test.token, ftpServer)
+		request := httptest.NewRequest("GET", "/sessions", nil)
+		request.Header.Set("Authorization", test.header)
+		recorder := httptest.NewRecorder()
+		admin.httpServer.Handler.ServeHTTP(recorder, request)
+		if recorder.Code != test.code {
+			t.Errorf("token %q, header %q: got %v, want %v", test.token, test.header, recorder.Code, test.code)
+		}
+		cleanup()
+	}
+}
+
+// waitSession returns the only session once its user is logged in
+func waitSession(t *testing.T, admin *FtpAdmin) SessionInfo {
+	for i := 0; i < 100; i++ {
+		var sessions []SessionInfo
+		json.Unmarshal(adminRequest(admin, "GET", "/sessions", "").Body.Bytes(), &sessions)
+		if len(sessions) == 1 && sessions[0].User == "ABC" {
+			return sessions[0]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("no session of ABC listed")
+	return SessionInfo{}
+}
+
+func TestAdminSessions(t *testing.T) {
+	ftpServer, addr, cleanup := startTestServer(t, nil)
+	defer cleanup()
+	admin := CreateFtpAdmin("127.0.0.1:0", "secret", ftpServer)
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.login()
+	info := waitSession(t, admin)
+	if info.Dir != "/" || info.Command != "" || info.Transfer != nil {
+		t.Errorf("session = %+v, want an idle session in /", info)
+	}
+
+	recorder := adminRequest(admin, "POST", "/broadcast", `{"message": "maintenance at noon\nsave your work"}`)
+	if recorder.Code != 200 || strings.TrimSpace(recorder.Body.String()) != `{"sessions":1}` {
+		t.Errorf("POST /broadcast = %v %q", recorder.Code, recorder.Body.String())
+	}
+	if recorder = adminRequest(admin, "POST", "/broadcast", `{}`); recorder.Code != 400 {
+		t.Errorf("POST /broadcast without message = %v, want 400", recorder.Code)
+	}
+	client.conn.Write([]byte("PWD\r\n"))
+	for _, want := range []string{"257-maintenance at noon", "257-save your work"} {
+		if line, _ := client.reader.ReadString('\n'); strings.TrimSpace(line) != want {
+			t.Errorf("got %q, want %q", line, want)
+		}
+	}
+	client.expect(257)
+
+	if recorder = adminRequest(admin, "DELETE", "/sessions?id=999", ""); recorder.Code != 404 {
+		t.Errorf("DELETE unknown session = %v, want 404", recorder.Code)
+	}
+	if recorder = adminRequest(admin, "DELETE", "/sessions?id=x", ""); recorder.Code != 400 {
+		t.Errorf("DELETE invalid id = %v, want 400", recorder.Code)
+	}
+	if recorder = adminRequest(admin, "DELETE", "/sessions?id="+strconv.FormatUint(info.ID, 10), ""); recorder.Code != 204 {
+		t.Errorf("DELETE session = %v, want 204", recorder.Code)
+	}
+	client.expect(421)
+	client.expectClosed()
+}
+
+func TestAdminSessionTransfer(t *testing.T) {
+	ftpServer, addr, cleanup := startTestServer(t, func(config *FtpConfig) {
+		ioutil.WriteFile(filepath.Join(config.RootDir, "big.bin"), bytes.Repeat([]byte("0123456789abcdef"), 1<<20), 0666)
+	})
+	defer cleanup()
+	admin := CreateFtpAdmin("127.0.0.1:0", "secret", ftpServer)
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.login()
+	dataAddr := client.pasv()
+	client.cmd("RETR big.bin", 150)
+	data, err := net.Dial("tcp", dataAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer data.Close()
+
+	// the transfer blocks as nothing reads, the session shows its file
+	info := waitSession(t, admin)
+	for i := 0; i < 100 && info.Transfer == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		info = waitSession(t, admin)
+	}
+	if info.Transfer == nil || info.Transfer.File != "/big.bin" || info.Transfer.Direction != "sent" || info.Transfer.Size != 16<<20 {
+		t.Errorf("session = %+v, want the transfer of /big.bin", info)
+	}
+	client.conn.Write([]byte("\xff\xf4\xff\xf2ABOR\r\n"))
+	client.expect(426)
+	client.expect(226)
+}
+
+func TestAdminBans(t *testing.T) {
+	ftpServer, _, cleanup := startTestServer(t, nil)
+	defer cleanup()
+	admin := CreateFtpAdmin("127.0.0.1:0", "secret", ftpServer)
+	for i := 0; i < ftpServer.settings.banFailures; i++ {
+		ftpServer.bans.RecordFailure("192.0.2.7")
+	}
+	var bans []map[string]interface{}
+	json.Unmarshal(adminRequest(admin, "GET", "/bans", "").Body.Bytes(), &bans)
+	if len(bans) != 1 {
+		t.Fatalf("GET /bans = %v, want 192.0.2.7", bans)
+	}
+	if recorder := adminRequest(admin, "DELETE", "/bans?ip=192.0.2.7", ""); recorder.Code != 204 {
+		t.Errorf("DELETE /bans = %v, want 204", recorder.Code)
+	}
+	if recorder := adminRequest(admin, "DELETE", "/bans?ip=192.0.2.7", ""); recorder.Code != 404 {
+		t.Errorf("DELETE /bans again = %v, want 404", recorder.Code)
+	}
+	if recorder := adminRequest(admin, "POST", "/bans", ""); recorder.Code != 405 {
+		t.Errorf("POST /bans = %v, want 405", recorder.Code)
+	}
+}
+
+func TestKickStalledClient(t *testing.T) {
+	config, cleanup := createTestConfig(t)
+	defer cleanup()
+	ftpServer, err := CreateFtpServer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, client := net.Pipe()
+	defer client.Close()
+	pi, err := CreateFtpPI(server, ftpServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the client never reads, the 421 is given up and the session closed
+	kicked := make(chan struct{})
+	go func() {
+		pi.Kick()
+		close(kicked)
+	}()
+	select {
+	case <-kicked:
+	case <-time.After(noticeWriteTimeout + 5*time.Second):
+		t.Fatalf("Kick blocked on a client which does not read")
+	}
+	if _, err = client.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("read after Kick = %v, want the session closed", err)
+	}
+}
@@ -0,0 +1,112 @@
+package ftpserver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrAuthFailed is returned by authenticators for a wrong user or password,
+// other errors mean the credentials could not be checked.
+var ErrAuthFailed = errors.New("wrong user name or password")
+
+// Account ...
+type Account struct {
+	User string
+	Pass string
+	Dir  string
+	// Access restricts the source addresses the account can log in from
+	Access *AccessList
+	// Options holds the other key=value columns of the account line
+	Options map[string]string
+}
+
+// CreateAccountListFromFile reads lines of "user pass dir [key=value ...]",
+// allow=<cidr,...> and deny=<cidr,...> restrict where the user logs in from,
+// umask=<octal> sets the mode of uploaded files, chmod=yes allows SITE
+// CHMOD and SITE UMASK, site_who=yes allows SITE WHO and charset=<name> sets
+// the encoding of file names.
+func CreateAccountListFromFile(accountFile string) ([]Account, error) {
+	file, err := os.OpenFile(accountFile, os.O_RDONLY, 0666)
+	if err != nil {
+		return make([]Account, 0), err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	accounts := make([]Account, 0)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		strs := strings.Fields(scanner.Text())
+		if len(strs) == 0 || strings.HasPrefix(strs[0], "#") {
+			continue
+		}
+		if len(strs) < 3 {
+			return accounts, fmt.Errorf("%v:%v: expected \"user pass dir\"", accountFile, lineNo)
+		}
+		account := Account{strs[0], strs[1], strs[2], &(AccessList{}), make(map[string]string)}
+		for _, option := range strs[3:] {
+			kv := strings.SplitN(option, "=", 2)
+			if len(kv) != 2 {
+				return accounts, fmt.Errorf("%v:%v: expected key=value, got %q", accountFile, lineNo, option)
+			}
+			switch kv[0] {
+			case "allow", "deny":
+				err = account.Access.Add(kv[0] == "allow", kv[1])
+				if err != nil {
+					return accounts, fmt.Errorf("%v:%v: %v", accountFile, lineNo, err)
+				}
+			case "charset":
+				if _, ok := LookupCharset(kv[1]); !ok {
+					return accounts, fmt.Errorf("%v:%v: unknown charset %v", accountFile, lineNo, kv[1])
+				}
+				account.Options[kv[0]] = kv[1]
+			case "umask":
+				if _, err = parseMode(kv[1]); err != nil {
+					return accounts, fmt.Errorf("%v:%v: %v", accountFile, lineNo, err)
+				}
+				account.Options[kv[0]] = kv[1]
+			default:
+				account.Options[kv[0]] = kv[1]
+			}
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, scanner.Err()
+}
+
+// Authenticator checks the credentials of a user and returns its account
+type Authenticator interface {
+	Authenticate(user string, pass string) (*Account, error)
+}
+
+// FileAuthenticator authenticates against an account file, read again on
+// every login so edits apply without a restart.
+type FileAuthenticator struct {
+	AccountFile string
+}
+
+// Authenticate ...
+func (auth *FileAuthenticator) Authenticate(user string, pass string) (*Account, error) {
+	accounts, err := CreateAccountListFromFile(auth.AccountFile)
+	if err != nil {
+		return nil, err
+	}
+	return Authenticate(user, pass, accounts)
+}
+
+// Ready checks that the account file can be read
+func (auth *FileAuthenticator) Ready() error {
+	_, err := CreateAccountListFromFile(auth.AccountFile)
+	return err
+}
+
+// Authenticate ...
+func Authenticate(user string, pass string, accounts []Account) (*Account, error) {
+	for i, v := range accounts {
+		if v.User == user && v.Pass == pass {
+			return &accounts[i], nil
+		}
+	}
+	return nil, ErrAuthFailed
+}
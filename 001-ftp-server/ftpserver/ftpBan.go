@@ -0,0 +1,97 @@
+package ftpserver
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// BanInfo ...
+type BanInfo struct {
+	IP          string    `json:"ip"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+	BannedUntil time.Time `json:"banned_until"`
+}
+
+// FtpBanList counts failed logins per IP across sessions and bans an IP
+// for a while once it reaches the threshold.
+type FtpBanList struct {
+	mutex     sync.Mutex
+	entries   map[string]*BanInfo
+	threshold int
+	duration  time.Duration
+}
+
+// CreateFtpBanList ...
+func CreateFtpBanList(threshold int, duration time.Duration) *FtpBanList {
+	return &(FtpBanList{entries: make(map[string]*BanInfo), threshold: threshold, duration: duration})
+}
+
+// IsBanned ...
+func (banList *FtpBanList) IsBanned(ip string) (bool, time.Time) {
+	banList.mutex.Lock()
+	defer banList.mutex.Unlock()
+	entry, ok := banList.entries[ip]
+	if !ok || !time.Now().Before(entry.BannedUntil) {
+		return false, time.Time{}
+	}
+	return true, entry.BannedUntil
+}
+
+// RecordFailure counts a failed login and reports whether the IP is now banned
+func (banList *FtpBanList) RecordFailure(ip string) bool {
+	if banList.threshold <= 0 {
+		return false
+	}
+	banList.mutex.Lock()
+	defer banList.mutex.Unlock()
+	now := time.Now()
+	banList.expire(now)
+	entry, ok := banList.entries[ip]
+	if !ok {
+		entry = &(BanInfo{IP: ip})
+		banList.entries[ip] = entry
+	}
+	entry.Failures++
+	entry.LastFailure = now
+	if entry.Failures >= banList.threshold && !now.Before(entry.BannedUntil) {
+		entry.BannedUntil = now.Add(banList.duration)
+		return true
+	}
+	return false
+}
+
+// List returns the IPs currently banned
+func (banList *FtpBanList) List() []BanInfo {
+	banList.mutex.Lock()
+	defer banList.mutex.Unlock()
+	now := time.Now()
+	banList.expire(now)
+	bans := make([]BanInfo, 0)
+	for _, entry := range banList.entries {
+		if now.Before(entry.BannedUntil) {
+			bans = append(bans, *entry)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].IP < bans[j].IP })
+	return bans
+}
+
+// Lift removes the ban and the failure count of an IP
+func (banList *FtpBanList) Lift(ip string) bool {
+	banList.mutex.Lock()
+	defer banList.mutex.Unlock()
+	_, ok := banList.entries[ip]
+	delete(banList.entries, ip)
+	return ok
+}
+
+// expire forgets failures older than the ban duration once any ban is over
+func (banList *FtpBanList) expire(now time.Time) {
+	for ip, entry := range banList.entries {
+		if now.Sub(entry.LastFailure) > banList.duration && !now.Before(entry.BannedUntil) {
+			delete(banList.entries, ip)
+		}
+	}
+}
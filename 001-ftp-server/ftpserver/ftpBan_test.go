@@ -0,0 +1,67 @@
+package ftpserver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBanList(t *testing.T) {
+	banList := CreateFtpBanList(3, time.Hour)
+	for i := 1; i <= 2; i++ {
+		if banList.RecordFailure("192.0.2.7") {
+			t.Fatalf("failure %v banned the IP, the threshold is 3", i)
+		}
+	}
+	if banned, _ := banList.IsBanned("192.0.2.7"); banned {
+		t.Fatalf("IP banned before the threshold")
+	}
+	if !banList.RecordFailure("192.0.2.7") {
+		t.Fatalf("failure 3 did not ban the IP")
+	}
+	if banList.RecordFailure("192.0.2.7") {
+		t.Errorf("a failure of a banned IP reported a new ban")
+	}
+	banned, until := banList.IsBanned("192.0.2.7")
+	if !banned || until.Before(time.Now().Add(59*time.Minute)) {
+		t.Errorf("IsBanned = %v, %v, want banned for an hour", banned, until)
+	}
+	if banned, _ := banList.IsBanned("192.0.2.8"); banned {
+		t.Errorf("another IP is banned")
+	}
+	bans := banList.List()
+	if len(bans) != 1 || bans[0].IP != "192.0.2.7" || bans[0].Failures != 4 {
+		t.Errorf("List = %+v, want 192.0.2.7 with 4 failures", bans)
+	}
+	if !banList.Lift("192.0.2.7") || banList.Lift("192.0.2.7") {
+		t.Errorf("Lift did not report the ban once")
+	}
+	if banned, _ := banList.IsBanned("192.0.2.7"); banned || len(banList.List()) != 0 {
+		t.Errorf("IP still banned after Lift")
+	}
+	if banList.RecordFailure("192.0.2.7") {
+		t.Errorf("Lift did not reset the failure count")
+	}
+}
+
+func TestBanListExpiry(t *testing.T) {
+	banList := CreateFtpBanList(1, 20*time.Millisecond)
+	if !banList.RecordFailure("192.0.2.7") {
+		t.Fatalf("failure did not ban the IP, the threshold is 1")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if banned, _ := banList.IsBanned("192.0.2.7"); banned {
+		t.Errorf("ban did not expire")
+	}
+	if len(banList.List()) != 0 {
+		t.Errorf("List keeps an expired ban")
+	}
+}
+
+func TestBanListDisabled(t *testing.T) {
+	banList := CreateFtpBanList(0, time.Hour)
+	for i := 0; i < 10; i++ {
+		if banList.RecordFailure("192.0.2.7") {
+			t.Fatalf("a threshold of 0 banned the IP")
+		}
+	}
+}
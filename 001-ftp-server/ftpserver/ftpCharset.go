@@ -0,0 +1,192 @@
+package ftpserver
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// Charset converts file names and replies between the encoding used by a
+// client and UTF-8, the encoding of names on disk. UTF-8, ISO-8859-1, GBK,
+// GB18030 and Shift_JIS are built in, others are added with
+// RegisterCharset.
+type Charset interface {
+	// Decode converts text sent by the client to UTF-8
+	Decode(s string) (string, error)
+	// Encode converts UTF-8 to the text sent to the client
+	Encode(s string) (string, error)
+}
+
+// utf8Charset passes text through, clients which never sent OPTS UTF8 may
+// send names in another encoding which are kept as they are
+type utf8Charset struct{}
+
+func (utf8Charset) Decode(s string) (string, error) {
+	return s, nil
+}
+
+func (utf8Charset) Encode(s string) (string, error) {
+	return s, nil
+}
+
+// latin1Charset is ISO-8859-1, whose bytes are the first 256 code points
+type latin1Charset struct{}
+
+func (latin1Charset) Decode(s string) (string, error) {
+	runes := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		runes[i] = rune(s[i])
+	}
+	return string(runes), nil
+}
+
+func (latin1Charset) Encode(s string) (string, error) {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xFF || r == utf8.RuneError {
+			return "", fmt.Errorf("%q cannot be encoded in ISO-8859-1", r)
+		}
+		out = append(out, byte(r))
+	}
+	return string(out), nil
+}
+
+// textCharset is an encoding of golang.org/x/text, vendored with the
+// server, an encoder fails on runes it cannot represent
+type textCharset struct {
+	encoding encoding.Encoding
+}
+
+func (c textCharset) Decode(s string) (string, error) {
+	return c.encoding.NewDecoder().String(s)
+}
+
+func (c textCharset) Encode(s string) (string, error) {
+	return c.encoding.NewEncoder().String(s)
+}
+
+const defaultCharset = "UTF-8"
+
+var (
+	charsetMutex sync.RWMutex
+	charsets     = map[string]Charset{"UTF-8": utf8Charset{}, "ISO-8859-1": latin1Charset{},
+		"GBK": textCharset{simplifiedchinese.GBK}, "GB18030": textCharset{simplifiedchinese.GB18030},
+		"SHIFT_JIS": textCharset{japanese.ShiftJIS}}
+)
+
+// RegisterCharset makes a charset available to the charset= option of
+// accounts and to SITE CHARSET, names are case insensitive. It must be
+// called before the server is created for the account file to accept it.
+func RegisterCharset(name string, charset Charset) {
+	charsetMutex.Lock()
+	defer charsetMutex.Unlock()
+	charsets[strings.ToUpper(name)] = charset
+}
+
+// LookupCharset ...
+func LookupCharset(name string) (Charset, bool) {
+	charsetMutex.RLock()
+	defer charsetMutex.RUnlock()
+	charset, ok := charsets[strings.ToUpper(name)]
+	return charset, ok
+}
+
+func charsetNames() []string {
+	charsetMutex.RLock()
+	defer charsetMutex.RUnlock()
+	names := make([]string, 0, len(charsets))
+	for name := range charsets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// encodeLine encodes a reply, it is sent as it is when it cannot be
+func encodeLine(charset Charset, line string) string {
+	if encoded, err := charset.Encode(line); err == nil {
+		return encoded
+	}
+	return line
+}
+
+// charsetWriter encodes each write, which holds whole lines
+type charsetWriter struct {
+	writer  io.Writer
+	charset Charset
+}
+
+func (w charsetWriter) Write(p []byte) (int, error) {
+	// a name which cannot be encoded is sent as it is on disk
+	if _, err := io.WriteString(w.writer, encodeLine(w.charset, string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// setCharset switches the encoding of the session, the name must be
+// registered
+func (ftpPI *FtpPI) setCharset(name string) error {
+	charset, ok := LookupCharset(name)
+	if !ok {
+		return fmt.Errorf("unknown charset %v", name)
+	}
+	// replies may be written by other goroutines, under writeMutex
+	ftpPI.writeMutex.Lock()
+	ftpPI.dtp.charset = charset
+	ftpPI.writeMutex.Unlock()
+	ftpPI.charsetName = strings.ToUpper(name)
+	return nil
+}
+
+// setAccountCharset applies the charset option of the account
+func (ftpPI *FtpPI) setAccountCharset(account *Account) {
+	ftpPI.accountCharset = defaultCharset
+	if name, ok := account.Options["charset"]; ok {
+		if _, known := LookupCharset(name); known {
+			ftpPI.accountCharset = name
+		} else {
+			ftpPI.logger.Warn("ignoring charset of the account", F("charset", name))
+		}
+	}
+	ftpPI.setCharset(ftpPI.accountCharset)
+}
+
+// HandleOPTSUTF8 switches to UTF-8 with ON, RFC 2640, and back to the
+// charset of the account with OFF
+func (ftpPI *FtpPI) HandleOPTSUTF8(value string) error {
+	switch strings.ToUpper(value) {
+	case "", "ON":
+		ftpPI.setCharset(defaultCharset)
+		ftpPI.writeMsg(200, "UTF8 set to on")
+	case "OFF":
+		ftpPI.setCharset(ftpPI.accountCharset)
+		ftpPI.writeMsg(200, fmt.Sprintf("UTF8 set to off, using %v", ftpPI.charsetName))
+	default:
+		ftpPI.writeMsgCode(501)
+		return fmt.Errorf("invalid UTF8 option %q", value)
+	}
+	return nil
+}
+
+// HandleSITECHARSET shows or sets the charset of the session
+func (ftpPI *FtpPI) HandleSITECHARSET(args string) error {
+	if args == "" {
+		ftpPI.writeMsg(200, fmt.Sprintf("Current charset is %v, available: %v.", ftpPI.charsetName,
+			strings.Join(charsetNames(), ", ")))
+		return nil
+	}
+	if err := ftpPI.setCharset(args); err != nil {
+		ftpPI.writeMsg(504, fmt.Sprintf("Unknown charset %v, available: %v.", args, strings.Join(charsetNames(), ", ")))
+		return err
+	}
+	ftpPI.writeMsg(200, fmt.Sprintf("Charset set to %v.", ftpPI.charsetName))
+	return nil
+}
@@ -0,0 +1,109 @@
+package ftpserver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCharsetRoundTrip(t *testing.T) {
+	tests := []struct {
+		charset string
+		text    string
+		encoded string
+		err     bool
+	}{
+		{"UTF-8", "中文.txt", "中文.txt", false},
+		{"ISO-8859-1", "café.txt", "caf\xe9.txt", false},
+		{"ISO-8859-1", "中文.txt", "", true},
+		{"GBK", "中文.txt", "\xd6\xd0\xce\xc4.txt", false},
+		{"gbk", "日本 é", "\xc8\xd5\xb1\xbe \xa8\xa6", false},
+		{"GBK", "😀", "", true},
+		{"GB18030", "😀 €", "\x94\x39\xfc\x36 \xa2\xe3", false},
+		{"Shift_JIS", "日本.txt", "\x93\xfa\x96\x7b.txt", false},
+		{"SHIFT_JIS", "中文 ｱ", "\x92\x86\x95\xb6 \xb1", false},
+		{"Shift_JIS", "é", "", true},
+	}
+	for _, test := range tests {
+		charset, ok := LookupCharset(test.charset)
+		if !ok {
+			t.Errorf("LookupCharset(%q) found nothing", test.charset)
+			continue
+		}
+		encoded, err := charset.Encode(test.text)
+		if (err != nil) != test.err {
+			t.Errorf("%v: Encode(%q) error = %v, want error %v", test.charset, test.text, err, test.err)
+			continue
+		}
+		if test.err {
+			continue
+		}
+		if encoded != test.encoded {
+			t.Errorf("%v: Encode(%q) = %q, want %q", test.charset, test.text, encoded, test.encoded)
+		}
+		if decoded, err := charset.Decode(encoded); err != nil || decoded != test.text {
+			t.Errorf("%v: Decode(%q) = %q, %v, want %q", test.charset, encoded, decoded, err, test.text)
+		}
+	}
+	if _, ok := LookupCharset("EUC-KR"); ok {
+		t.Errorf("LookupCharset(EUC-KR) found a charset which is not built in")
+	}
+}
+
+func TestCharsetSession(t *testing.T) {
+	_, addr, cleanup := startTestServer(t, func(config *FtpConfig) {
+		ioutil.WriteFile(config.AccountFile, []byte("ABC 12345678 /ABC charset=GBK\n"), 0666)
+		os.Mkdir(filepath.Join(config.RootDir, "ABC"), 0777)
+		ioutil.WriteFile(filepath.Join(config.RootDir, "ABC", "中文.txt"), []byte("a"), 0666)
+	})
+	defer cleanup()
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.login()
+
+	// GBK names in commands, replies and listings
+	client.cmd("CWD /ABC", 250)
+	client.cmd("MDTM \xd6\xd0\xce\xc4.txt", 213)
+	if reply := client.cmd("MFMT 20200102030405 \xd6\xd0\xce\xc4.txt", 213); reply != "213 Modify=20200102030405; \xd6\xd0\xce\xc4.txt" {
+		t.Errorf("MFMT in GBK = %q", reply)
+	}
+	if names := client.list("NLST"); !reflect.DeepEqual(names, []string{"\xd6\xd0\xce\xc4.txt"}) {
+		t.Errorf("NLST in GBK = %q", names)
+	}
+	client.cmd("MDTM 中文.txt", 550)
+
+	client.cmd("OPTS UTF8 ON", 200)
+	client.cmd("MDTM 中文.txt", 213)
+	if names := client.list("NLST"); !reflect.DeepEqual(names, []string{"中文.txt"}) {
+		t.Errorf("NLST in UTF-8 = %q", names)
+	}
+	client.cmd("OPTS UTF8 OFF", 200)
+	client.cmd("MDTM \xd6\xd0\xce\xc4.txt", 213)
+	client.cmd("SITE CHARSET Shift_JIS", 200)
+	client.cmd("MDTM \x92\x86\x95\xb6.txt", 213)
+	client.cmd("SITE CHARSET EUC-KR", 504)
+	client.cmd("SITE CHARSET", 200)
+}
+
+func TestCharsetLogin(t *testing.T) {
+	_, addr, cleanup := startTestServer(t, func(config *FtpConfig) {
+		ioutil.WriteFile(config.AccountFile, []byte("ABC 12345678 /ABC charset=GBK\n"+
+			"DEF p\xd6\xd0 /ABC charset=GBK\n\xd6\xd0 pw /ABC charset=GBK\n"), 0666)
+		os.Mkdir(filepath.Join(config.RootDir, "ABC"), 0777)
+	})
+	defer cleanup()
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.login()
+
+	// the GBK session of ABC does not decode the credentials of the next
+	// login
+	client.cmd("USER DEF", 331)
+	client.cmd("PASS p\xd6\xd0", 230)
+	client.cmd("USER DEF", 331)
+	client.cmd("USER \xd6\xd0", 331)
+	client.cmd("PASS pw", 230)
+	client.cmd("PWD", 257)
+}
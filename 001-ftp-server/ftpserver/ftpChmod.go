@@ -0,0 +1,132 @@
+package ftpserver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// parseMode parses an octal permission mode such as 644 or 0022, special
+// bits such as setuid are refused
+func parseMode(value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid mode %q, expected octal permissions up to 777", value)
+	}
+	return os.FileMode(mode), nil
+}
+
+// applyUmask sets the mode of a file created by STOR from the umask of the
+// account, the storage keeps its own mode when none is set
+func (ftpDTP *FtpDTP) applyUmask(path string) error {
+	if ftpDTP.umask < 0 {
+		return nil
+	}
+	chmoder, ok := ftpDTP.storage.(Chmoder)
+	if !ok {
+		return nil
+	}
+	return chmoder.Chmod(path, 0666&^os.FileMode(ftpDTP.umask))
+}
+
+// setAccountMode applies the umask and chmod options of the account, SITE
+// CHMOD is confined to the directory of the account
+func (ftpPI *FtpPI) setAccountMode(account *Account) {
+	ftpPI.dtp.umask = -1
+	if value, ok := account.Options["umask"]; ok {
+		umask, err := parseMode(value)
+		if err != nil {
+			ftpPI.logger.Warn("ignoring umask of the account", F("error", err))
+		} else {
+			ftpPI.dtp.umask = int(umask)
+		}
+	}
+	ftpPI.allowChmod = account.Options["chmod"] == "yes"
+	ftpPI.homePath = filepath.Join(ftpPI.settings.rootDir, filepath.FromSlash(account.Dir))
+}
+
+// insideHome reports whether path is below the directory of the account,
+// which itself and the root directory are not
+func (ftpPI *FtpPI) insideHome(path string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(absPath, ftpPI.homePath+string(filepath.Separator))
+}
+
+// checkChmod replies 550 when the account or the storage cannot change
+// modes
+func (ftpPI *FtpPI) checkChmod() (Chmoder, error) {
+	chmoder, ok := ftpPI.dtp.storage.(Chmoder)
+	if !ok {
+		ftpPI.writeMsgCode(502)
+		return nil, fmt.Errorf("storage cannot change modes")
+	}
+	if !ftpPI.allowChmod {
+		ftpPI.writeMsg(550, "Permission denied.")
+		return nil, fmt.Errorf("user %v cannot change modes", ftpPI.user)
+	}
+	return chmoder, nil
+}
+
+// HandleSITECHMOD sets the mode of a file or directory, "SITE CHMOD <mode>
+// <path>"
+func (ftpPI *FtpPI) HandleSITECHMOD(args string) error {
+	fields := strings.SplitN(args, " ", 2)
+	if len(fields) != 2 {
+		ftpPI.writeMsg(501, "Syntax: SITE CHMOD <mode> <path>")
+		return fmt.Errorf("invalid arguments %q", args)
+	}
+	mode, err := parseMode(fields[0])
+	if err != nil {
+		ftpPI.writeMsg(501, "Mode must be octal permissions up to 777.")
+		return err
+	}
+	chmoder, err := ftpPI.checkChmod()
+	if err != nil {
+		return err
+	}
+	path := ftpPI.resolvePath(fields[1])
+	if !ftpPI.dtp.ValidPath(path) {
+		ftpPI.writeMsg(550, "File not found.")
+		return fmt.Errorf("invalid path %v", path)
+	}
+	if !ftpPI.insideHome(path) {
+		ftpPI.writeMsg(550, "Permission denied.")
+		return fmt.Errorf("path %v is outside the directory of %v", path, ftpPI.user)
+	}
+	if err = chmoder.Chmod(path, mode); err != nil {
+		ftpPI.writeMsg(550, "Cannot change the mode.")
+		return err
+	}
+	ftpPI.logger.Info("mode changed", F("path", path), F("mode", fmt.Sprintf("%03o", mode)))
+	ftpPI.dtp.fireEvent(Event{Type: EventChmod, File: path})
+	ftpPI.writeMsg(200, "SITE CHMOD command successful.")
+	return nil
+}
+
+// HandleSITEUMASK shows or sets the umask of the session
+func (ftpPI *FtpPI) HandleSITEUMASK(args string) error {
+	if args == "" {
+		if ftpPI.dtp.umask < 0 {
+			ftpPI.writeMsg(200, "No umask set, files get the mode of the storage.")
+		} else {
+			ftpPI.writeMsg(200, fmt.Sprintf("Current umask is %03o.", ftpPI.dtp.umask))
+		}
+		return nil
+	}
+	umask, err := parseMode(args)
+	if err != nil {
+		ftpPI.writeMsg(501, "Umask must be octal permissions up to 777.")
+		return err
+	}
+	if _, err = ftpPI.checkChmod(); err != nil {
+		return err
+	}
+	ftpPI.dtp.umask = int(umask)
+	ftpPI.writeMsg(200, fmt.Sprintf("Umask set to %03o.", umask))
+	return nil
+}
@@ -0,0 +1,136 @@
+package ftpserver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		value string
+		mode  os.FileMode
+		err   bool
+	}{
+		{"644", 0644, false},
+		{"0644", 0644, false},
+		{"022", 0022, false},
+		{"0", 0, false},
+		{"777", 0777, false},
+		{"1777", 0, true},
+		{"4755", 0, true},
+		{"648", 0, true},
+		{"-644", 0, true},
+		{"rw-r--r--", 0, true},
+		{"", 0, true},
+	}
+	for _, test := range tests {
+		mode, err := parseMode(test.value)
+		if (err != nil) != test.err {
+			t.Errorf("parseMode(%q) error = %v, want error %v", test.value, err, test.err)
+		} else if mode != test.mode {
+			t.Errorf("parseMode(%q) = %v, want %v", test.value, mode, test.mode)
+		}
+	}
+}
+
+// startChmodServer serves an ABC account with the options, its directory
+// holds a.txt and sub, the root c.txt and other/b.txt, all 0644 or 0755
+func startChmodServer(t *testing.T, options string) (string, string, func()) {
+	var rootDir string
+	_, addr, cleanup := startTestServer(t, func(config *FtpConfig) {
+		rootDir = config.RootDir
+		ioutil.WriteFile(config.AccountFile, []byte("ABC 12345678 /ABC "+options+"\n"), 0666)
+	})
+	for _, dir := range []string{"ABC", "ABC/sub", "other"} {
+		os.Mkdir(filepath.Join(rootDir, dir), 0755)
+		os.Chmod(filepath.Join(rootDir, dir), 0755)
+	}
+	for _, file := range []string{"ABC/a.txt", "other/b.txt", "c.txt"} {
+		ioutil.WriteFile(filepath.Join(rootDir, file), []byte(file), 0644)
+		os.Chmod(filepath.Join(rootDir, file), 0644)
+	}
+	return rootDir, addr, cleanup
+}
+
+func checkMode(t *testing.T, path string, want os.FileMode) {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		t.Errorf("%v: %v", path, err)
+	} else if fileInfo.Mode().Perm() != want {
+		t.Errorf("%v: mode %v, want %v", path, fileInfo.Mode().Perm(), want)
+	}
+}
+
+func TestSITECHMOD(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows only keeps the read-only bit")
+	}
+	rootDir, addr, cleanup := startChmodServer(t, "chmod=yes")
+	defer cleanup()
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.login()
+	tests := []struct {
+		command string
+		code    int
+		file    string
+		mode    os.FileMode
+	}{
+		{"SITE CHMOD 600 /ABC/a.txt", 200, "ABC/a.txt", 0600},
+		{"SITE CHMOD 0750 /ABC/sub", 200, "ABC/sub", 0750},
+		{"SITE CHMOD 640 /ABC/sub/../a.txt", 200, "ABC/a.txt", 0640},
+		{"SITE CHMOD 700 /ABC", 550, "ABC", 0755},
+		{"SITE CHMOD 700 /", 550, "", 0},
+		{"SITE CHMOD 600 /c.txt", 550, "c.txt", 0644},
+		{"SITE CHMOD 600 /other/b.txt", 550, "other/b.txt", 0644},
+		{"SITE CHMOD 600 /ABC/../other/b.txt", 550, "other/b.txt", 0644},
+		{"SITE CHMOD 600 /ABC/missing.txt", 550, "", 0},
+		{"SITE CHMOD 4755 /ABC/a.txt", 501, "ABC/a.txt", 0640},
+		{"SITE CHMOD 600", 501, "", 0},
+	}
+	for _, test := range tests {
+		client.cmd(test.command, test.code)
+		if test.mode != 0 {
+			checkMode(t, filepath.Join(rootDir, test.file), test.mode)
+		}
+	}
+}
+
+func TestSITEUMASK(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows only keeps the read-only bit")
+	}
+	rootDir, addr, cleanup := startChmodServer(t, "chmod=yes umask=027")
+	defer cleanup()
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.login()
+	client.cmd("SITE UMASK", 200)
+	client.stor("/ABC/up.txt", "up")
+	checkMode(t, filepath.Join(rootDir, "ABC/up.txt"), 0640)
+	client.cmd("MKD /ABC/dir", 257)
+	checkMode(t, filepath.Join(rootDir, "ABC/dir"), 0750)
+	client.cmd("SITE UMASK 077", 200)
+	client.cmd("SITE UMASK 0x1", 501)
+	client.stor("/ABC/private.txt", "private")
+	checkMode(t, filepath.Join(rootDir, "ABC/private.txt"), 0600)
+	client.cmd("XMKD /ABC/private", 257)
+	checkMode(t, filepath.Join(rootDir, "ABC/private"), 0700)
+}
+
+func TestSITECHMODNotAllowed(t *testing.T) {
+	rootDir, addr, cleanup := startChmodServer(t, "umask=027")
+	defer cleanup()
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.login()
+	client.cmd("SITE CHMOD 600 /ABC/a.txt", 550)
+	client.cmd("SITE UMASK 077", 550)
+	client.cmd("SITE UMASK", 200)
+	if runtime.GOOS != "windows" {
+		checkMode(t, filepath.Join(rootDir, "ABC/a.txt"), 0644)
+	}
+}
@@ -0,0 +1,195 @@
+package ftpserver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ArgPolicy tells whether a command takes an argument
+type ArgPolicy int
+
+const (
+	// ArgsOptional lets the handler check the argument
+	ArgsOptional ArgPolicy = iota
+	// ArgsRequired rejects the command with 501 when it has no argument
+	ArgsRequired
+	// ArgsNone rejects the command with 501 when it has an argument
+	ArgsNone
+)
+
+// Command is a command of the control connection or a SITE subcommand
+type Command struct {
+	Name string
+	// NeedAuth rejects the command with 530 before login
+	NeedAuth bool
+	Args     ArgPolicy
+	// Syntax and Help are the usage given by HELP
+	Syntax string
+	Help   string
+	// Handler replies to the command, args is its argument, or what
+	// follows the name of a SITE subcommand
+	Handler func(ftpPI *FtpPI, args string) error
+	// quit ends the session once the command is handled
+	quit bool
+}
+
+// check replies 530 or 501 when the command cannot run with args
+func (command *Command) check(ftpPI *FtpPI, args string) error {
+	if command.NeedAuth && !ftpPI.auth {
+		ftpPI.writeMsgCode(530)
+		return fmt.Errorf("user not log in")
+	}
+	if (command.Args == ArgsRequired && args == "") || (command.Args == ArgsNone && args != "") {
+		ftpPI.writeMsg(501, "Syntax: "+command.Syntax)
+		return fmt.Errorf("invalid arguments %q for %v", args, command.Name)
+	}
+	return nil
+}
+
+// method adapts a handler reading its argument from the session
+func method(handler func(*FtpPI) error) func(*FtpPI, string) error {
+	return func(ftpPI *FtpPI, args string) error {
+		return handler(ftpPI)
+	}
+}
+
+func xHash(algorithm string) func(*FtpPI, string) error {
+	return func(ftpPI *FtpPI, args string) error {
+		return ftpPI.HandleXHASH(algorithm)
+	}
+}
+
+// commandTable holds the commands of the control connection by name
+var commandTable = make(map[string]*Command)
+
+func init() {
+	for _, command := range []*Command{
+		{Name: "USER", Syntax: "USER <name>", Help: "Set the user name.", Handler: method((*FtpPI).HandleUSER)},
+		{Name: "PASS", Syntax: "PASS <password>", Help: "Log in with the password.", Handler: method((*FtpPI).HandlePASS)},
+		{Name: "SYST", Args: ArgsNone, Syntax: "SYST", Help: "Show the system type.", Handler: method((*FtpPI).HandleSYST)},
+		{Name: "FEAT", Args: ArgsNone, Syntax: "FEAT", Help: "List the extensions.", Handler: method((*FtpPI).HandleFEAT)},
+		{Name: "OPTS", Args: ArgsRequired, Syntax: "OPTS <option> [<value>]", Help: "Set an option of an extension.",
+			Handler: method((*FtpPI).HandleOPTS)},
+		{Name: "HELP", Syntax: "HELP [<command>]", Help: "List the commands or show the usage of one.", Handler: (*FtpPI).HandleHELP},
+		{Name: "TYPE", NeedAuth: true, Args: ArgsRequired, Syntax: "TYPE A|I", Help: "Set the transfer type, ASCII or binary.",
+			Handler: method((*FtpPI).HandleTYPE)},
+		{Name: "PASV", NeedAuth: true, Args: ArgsNone, Syntax: "PASV", Help: "Open a passive data port.", Handler: method((*FtpPI).HandlePASV)},
+		{Name: "LIST", NeedAuth: true, Syntax: "LIST [-aRt] [<path>]", Help: "List files in long format.", Handler: method((*FtpPI).HandleLIST)},
+		{Name: "NLST", NeedAuth: true, Syntax: "NLST [-alRt] [<path>]", Help: "List file names.", Handler: method((*FtpPI).HandleNLST)},
+		{Name: "CWD", NeedAuth: true, Args: ArgsRequired, Syntax: "CWD <dir>", Help: "Change the working directory.",
+			Handler: method((*FtpPI).HandleCWD)},
+		{Name: "CDUP", NeedAuth: true, Args: ArgsNone, Syntax: "CDUP", Help: "Change to the parent directory.",
+			Handler: method((*FtpPI).HandleCDUP)},
+		{Name: "PWD", NeedAuth: true, Args: ArgsNone, Syntax: "PWD", Help: "Show the working directory.", Handler: method((*FtpPI).HandlePWD)},
+		{Name: "RETR", NeedAuth: true, Args: ArgsRequired, Syntax: "RETR <file>", Help: "Download a file.", Handler: method((*FtpPI).HandleRETR)},
+		{Name: "STOR", NeedAuth: true, Args: ArgsRequired, Syntax: "STOR <file>", Help: "Upload a file.", Handler: method((*FtpPI).HandleSTOR)},
+		{Name: "STOU", NeedAuth: true, Syntax: "STOU [<file>]", Help: "Upload a file under a new unique name.",
+			Handler: method((*FtpPI).HandleSTOU)},
+		{Name: "MKD", NeedAuth: true, Args: ArgsRequired, Syntax: "MKD <dir>", Help: "Create a directory.", Handler: method((*FtpPI).HandleMKD)},
+		{Name: "XMKD", NeedAuth: true, Args: ArgsRequired, Syntax: "XMKD <dir>", Help: "Create a directory, as MKD.",
+			Handler: method((*FtpPI).HandleMKD)},
+		{Name: "MDTM", NeedAuth: true, Args: ArgsRequired, Syntax: "MDTM <file>", Help: "Show the modification time of a file.",
+			Handler: method((*FtpPI).HandleMDTM)},
+		{Name: "MFMT", NeedAuth: true, Args: ArgsRequired, Syntax: "MFMT <YYYYMMDDHHMMSS> <file>", Help: "Set the modification time of a file.",
+			Handler: method((*FtpPI).HandleMFMT)},
+		{Name: "MFCT", NeedAuth: true, Args: ArgsRequired, Syntax: "MFCT <YYYYMMDDHHMMSS> <file>", Help: "Set the creation time of a file.",
+			Handler: method((*FtpPI).HandleMFCT)},
+		{Name: "HASH", NeedAuth: true, Args: ArgsRequired, Syntax: "HASH <file>", Help: "Show the checksum of a file.",
+			Handler: method((*FtpPI).HandleHASH)},
+		{Name: "RANG", NeedAuth: true, Args: ArgsRequired, Syntax: "RANG <start> <end>", Help: "Set the byte range of the next HASH.",
+			Handler: method((*FtpPI).HandleRANG)},
+		{Name: "XCRC", NeedAuth: true, Args: ArgsRequired, Syntax: "XCRC <file> [<start> [<end>]]", Help: "Show the CRC32 of a file.",
+			Handler: xHash("CRC32")},
+		{Name: "XMD5", NeedAuth: true, Args: ArgsRequired, Syntax: "XMD5 <file> [<start> [<end>]]", Help: "Show the MD5 of a file.",
+			Handler: xHash("MD5")},
+		{Name: "XSHA1", NeedAuth: true, Args: ArgsRequired, Syntax: "XSHA1 <file> [<start> [<end>]]", Help: "Show the SHA-1 of a file.",
+			Handler: xHash("SHA-1")},
+		{Name: "XSHA256", NeedAuth: true, Args: ArgsRequired, Syntax: "XSHA256 <file> [<start> [<end>]]", Help: "Show the SHA-256 of a file.",
+			Handler: xHash("SHA-256")},
+		{Name: "SITE", NeedAuth: true, Args: ArgsRequired, Syntax: "SITE <command> [<args>]", Help: "Run a server specific command, see SITE HELP.",
+			Handler: (*FtpPI).HandleSITE},
+		{Name: "STAT", Syntax: "STAT [<path>]", Help: "Show the session status, or list a path.", Handler: method((*FtpPI).HandleSTAT)},
+		{Name: "ABOR", Args: ArgsNone, Syntax: "ABOR", Help: "Abort the running transfer.", Handler: method((*FtpPI).HandleABOR)},
+		{Name: "NOOP", Args: ArgsNone, Syntax: "NOOP", Help: "Do nothing.", Handler: method((*FtpPI).HandleNOOP)},
+		{Name: "QUIT", Syntax: "QUIT", Help: "End the session.", Handler: method((*FtpPI).HandleQUIT), quit: true},
+	} {
+		commandTable[command.Name] = command
+	}
+}
+
+// HandleCommand runs the command read by Serve, it reports whether the
+// session ends
+func (ftpPI *FtpPI) HandleCommand() (bool, error) {
+	if err := ftpPI.checkDuringTransfer(); err != nil {
+		return false, err
+	}
+	command, ok := commandTable[ftpPI.comm]
+	if !ok {
+		ftpPI.writeMsgCode(502)
+		return false, fmt.Errorf("command %v not supported", ftpPI.comm)
+	}
+	// credentials are checked as sent, the charset of the session belongs
+	// to the account logged in before
+	if ftpPI.comm != "PASS" && (ftpPI.comm != "USER" || ftpPI.auth) {
+		para, err := ftpPI.dtp.charset.Decode(ftpPI.para)
+		if err != nil {
+			ftpPI.writeMsg(501, fmt.Sprintf("Argument is not valid %v.", ftpPI.charsetName))
+			return false, err
+		}
+		ftpPI.para = para
+	}
+	if err := command.check(ftpPI, ftpPI.para); err != nil {
+		return false, err
+	}
+	err := command.Handler(ftpPI, ftpPI.para)
+	return command.quit || err == errLoginBlocked, err
+}
+
+// HandleHELP lists the commands, or shows the usage of one
+func (ftpPI *FtpPI) HandleHELP(args string) error {
+	if args == "" {
+		ftpPI.writeLine(multiLine(214, "The following commands are recognized:", commandColumns(commandTable), "Help OK."))
+		return nil
+	}
+	command, ok := commandTable[strings.ToUpper(args)]
+	if !ok {
+		ftpPI.writeMsg(502, fmt.Sprintf("Unknown command %v.", args))
+		return fmt.Errorf("no help for %v", args)
+	}
+	ftpPI.writeMsg(214, fmt.Sprintf("Syntax: %v - %v", command.Syntax, command.Help))
+	return nil
+}
+
+// commandColumns lays the command names out in rows of eight
+func commandColumns(commands map[string]*Command) []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var lines []string
+	for i := 0; i < len(names); i += 8 {
+		end := i + 8
+		if end > len(names) {
+			end = len(names)
+		}
+		row := make([]string, 0, 8)
+		for _, name := range names[i:end] {
+			row = append(row, fmt.Sprintf("%-8v", name))
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(row, ""), " "))
+	}
+	return lines
+}
+
+// Reply writes a reply to the session, a message of several lines becomes
+// a multi-line reply. SITE handlers registered by embedders use it.
+func (ftpPI *FtpPI) Reply(code int, message string) {
+	lines := strings.Split(strings.Replace(message, "\r", "", -1), "\n")
+	if len(lines) == 1 {
+		ftpPI.writeMsg(code, message)
+		return
+	}
+	ftpPI.writeLine(multiLine(code, lines[0], lines[1:len(lines)-1], lines[len(lines)-1]))
+}
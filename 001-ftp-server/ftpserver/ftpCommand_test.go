@@ -0,0 +1,92 @@
+package ftpserver
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCommandColumns(t *testing.T) {
+	commands := make(map[string]*Command)
+	for _, name := range []string{"J", "I", "H", "G", "F", "E", "D", "C", "B", "A"} {
+		commands[name] = &(Command{Name: name})
+	}
+	want := []string{"A       B       C       D       E       F       G       H", "I       J"}
+	if got := commandColumns(commands); !reflect.DeepEqual(got, want) {
+		t.Errorf("commandColumns = %q, want %q", got, want)
+	}
+}
+
+func TestHELP(t *testing.T) {
+	_, addr, cleanup := startTestServer(t, nil)
+	defer cleanup()
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+
+	// HELP and the argument checks of the registry work before login
+	lines := client.multi("HELP", 214)
+	if all := strings.Join(lines, " "); !strings.Contains(all, "RETR") || !strings.Contains(all, "XSHA256") {
+		t.Errorf("HELP = %q, want every command", lines)
+	}
+	client.cmd("HELP retr", 214)
+	client.cmd("HELP BOGUS", 502)
+	client.cmd("BOGUS", 502)
+	client.cmd("PWD", 530)
+	client.cmd("SITE HELP", 530)
+	client.cmd("NOOP extra", 501)
+	client.login()
+	client.cmd("CWD", 501)
+	client.cmd("QUIT", 221)
+	client.expectClosed()
+}
+
+func TestSITE(t *testing.T) {
+	ftpServer, addr, cleanup := startTestServer(t, func(config *FtpConfig) {
+		ioutil.WriteFile(config.AccountFile, []byte("ABC 12345678 /ABC\nWHO secret / site_who=yes\n"), 0666)
+	})
+	defer cleanup()
+	if err := ftpServer.RegisterSiteCommand(Command{Name: "bad name", Handler: (*FtpPI).HandleSITEHELP}); err == nil {
+		t.Errorf("RegisterSiteCommand accepted a name with a space")
+	}
+	var got string
+	err := ftpServer.RegisterSiteCommand(Command{Name: "echo", Args: ArgsRequired, Help: "Echo the arguments.",
+		Handler: func(ftpPI *FtpPI, args string) error {
+			got = args
+			ftpPI.Reply(200, "Echo:\n"+args+"\nDone.")
+			return nil
+		}})
+	if err != nil {
+		t.Fatalf("RegisterSiteCommand: %v", err)
+	}
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.login()
+
+	lines := client.multi("SITE HELP", 214)
+	if all := strings.Join(lines, " "); !strings.Contains(all, "ECHO") || !strings.Contains(all, "IDLE") {
+		t.Errorf("SITE HELP = %q, want ECHO and IDLE", lines)
+	}
+	client.cmd("SITE HELP echo", 214)
+	client.cmd("SITE HELP BOGUS", 502)
+	client.cmd("SITE BOGUS", 502)
+	client.cmd("SITE ECHO", 501)
+	if lines = client.multi("SITE echo a  b", 200); !reflect.DeepEqual(lines, []string{"a  b"}) || got != "a  b" {
+		t.Errorf("SITE ECHO = %q, handler got %q, want a  b", lines, got)
+	}
+
+	client.cmd("SITE IDLE", 200)
+	client.cmd("SITE IDLE 60", 200)
+	client.cmd("SITE IDLE 0", 501)
+	client.cmd("SITE IDLE 100000", 501)
+
+	// only accounts with site_who=yes list the sessions
+	client.cmd("SITE WHO", 550)
+	who := dialTestClient(t, addr)
+	defer who.conn.Close()
+	who.cmd("USER WHO", 331)
+	who.cmd("PASS secret", 230)
+	if lines = who.multi("SITE WHO", 211); len(lines) != 2 || !strings.Contains(strings.Join(lines, " "), "ABC") {
+		t.Errorf("SITE WHO = %q, want the sessions of ABC and WHO", lines)
+	}
+}
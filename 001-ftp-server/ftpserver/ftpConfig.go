@@ -0,0 +1,515 @@
+package ftpserver
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FtpConfig is the server configuration, read from a TOML file whose keys
+// are given by the toml tags, then overridden by MYFTP_<SECTION>_<KEY>
+// environment variables.
+type FtpConfig struct {
+	RootDir     string        `toml:"root_dir"`
+	AccountFile string        `toml:"account_file"`
+	AccessFile  string        `toml:"access_file"`
+	Listen      ListenConfig  `toml:"listen"`
+	Log         LogConfig     `toml:"log"`
+	XferLog     XferLogConfig `toml:"xferlog"`
+	Passive     PassiveConfig `toml:"passive"`
+	Limits      LimitsConfig  `toml:"limits"`
+	Proxy       ProxyConfig   `toml:"proxy"`
+	Admin       AdminConfig   `toml:"admin"`
+	Metrics     MetricsConfig `toml:"metrics"`
+	Health      HealthConfig  `toml:"health"`
+	Upload      UploadConfig  `toml:"upload"`
+	Hooks       HooksConfig   `toml:"hooks"`
+	// Authenticator and Storage replace the account file and the local file
+	// system when set, embedders set them from Go code only.
+	Authenticator Authenticator `toml:"-"`
+	Storage       Storage       `toml:"-"`
+}
+
+// ListenConfig ...
+type ListenConfig struct {
+	Addresses []string `toml:"addresses"`
+}
+
+// LogConfig ...
+type LogConfig struct {
+	// File is a path, or "stdout" or "stderr"
+	File   string `toml:"file"`
+	Format string `toml:"format"`
+	Level  string `toml:"level"`
+	// the file rotates past MaxSizeMB or after RotateInterval, 0 disables either
+	MaxSizeMB      int           `toml:"max_size_mb"`
+	RotateInterval time.Duration `toml:"rotate_interval"`
+	MaxBackups     int           `toml:"max_backups"`
+	Compress       bool          `toml:"compress"`
+}
+
+// XferLogConfig ...
+type XferLogConfig struct {
+	// File is empty to disable the transfer log
+	File           string        `toml:"file"`
+	MaxSizeMB      int           `toml:"max_size_mb"`
+	RotateInterval time.Duration `toml:"rotate_interval"`
+	MaxBackups     int           `toml:"max_backups"`
+	Compress       bool          `toml:"compress"`
+}
+
+// PassiveConfig ...
+type PassiveConfig struct {
+	MinPort int    `toml:"min_port"`
+	MaxPort int    `toml:"max_port"`
+	Address string `toml:"address"`
+	// AddressMap holds "local=public" pairs, public may be a host name
+	AddressMap []string      `toml:"address_map"`
+	Timeout    time.Duration `toml:"timeout"`
+}
+
+// LimitsConfig ...
+type LimitsConfig struct {
+	IdleTimeout      time.Duration `toml:"idle_timeout"`
+	LoginTimeout     time.Duration `toml:"login_timeout"`
+	TransferTimeout  time.Duration `toml:"transfer_timeout"`
+	MaxLoginAttempts int           `toml:"max_login_attempts"`
+	LoginFailDelay   time.Duration `toml:"login_fail_delay"`
+	BanFailures      int           `toml:"ban_failures"`
+	BanDuration      time.Duration `toml:"ban_duration"`
+	ShutdownGrace    time.Duration `toml:"shutdown_grace"`
+}
+
+// ProxyConfig ...
+type ProxyConfig struct {
+	Enabled bool     `toml:"enabled"`
+	Trusted []string `toml:"trusted"`
+}
+
+// AdminConfig ...
+type AdminConfig struct {
+	Listen string `toml:"listen"`
+	// Token is required in an "Authorization: Bearer" header
+	Token string `toml:"token"`
+}
+
+// MetricsConfig ...
+type MetricsConfig struct {
+	// Listen serves /metrics in the Prometheus format, empty to disable
+	Listen string `toml:"listen"`
+}
+
+// HealthConfig ...
+type HealthConfig struct {
+	// Listen serves /healthz and /readyz, empty to disable
+	Listen string `toml:"listen"`
+}
+
+// UploadConfig ...
+type UploadConfig struct {
+	// Overwrite is what STOR does with an existing file: allow, deny,
+	// rename or timestamp
+	Overwrite string `toml:"overwrite"`
+	// OverwriteDirs holds "dir=policy" pairs, dir is below the root
+	// directory and covers its subdirectories
+	OverwriteDirs []string `toml:"overwrite_dirs"`
+}
+
+// HooksConfig ...
+type HooksConfig struct {
+	// Webhooks are URLs receiving every event as a JSON POST
+	Webhooks []string `toml:"webhooks"`
+	// Secret signs the webhook bodies with HMAC-SHA256, empty to disable
+	Secret string `toml:"secret"`
+	// Command is the path of a program run for every event, never split
+	// into arguments
+	Command string `toml:"command"`
+	// Events are the event types delivered, empty for all
+	Events     []string      `toml:"events"`
+	Retries    int           `toml:"retries"`
+	RetryDelay time.Duration `toml:"retry_delay"`
+	Timeout    time.Duration `toml:"timeout"`
+	QueueSize  int           `toml:"queue_size"`
+}
+
+// DefaultFtpConfig returns the configuration of the container image
+func DefaultFtpConfig() *FtpConfig {
+	return &(FtpConfig{
+		RootDir:     "/go/src/myftp/ftpdir",
+		AccountFile: "/go/src/myftp/ftpAccounts.dat",
+		AccessFile:  "/go/src/myftp/ftpAccess.dat",
+		Listen:      ListenConfig{[]string{":2121"}},
+		Log:         LogConfig{"/go/src/myftp/MyFtpLog.log", "text", "info", 100, 0, 7, true},
+		XferLog:     XferLogConfig{"", 100, 0, 7, true},
+		Passive:     PassiveConfig{defaultPasvMinPort, defaultPasvMaxPort, "", []string{}, defaultPasvTimeout},
+		Limits: LimitsConfig{defaultIdleTimeout, defaultLoginTimeout, defaultTransferTimeout,
+			defaultMaxLoginAttempts, defaultLoginFailDelay, defaultBanFailures, defaultBanDuration, defaultShutdownGrace},
+		Proxy:   ProxyConfig{false, []string{}},
+		Admin:   AdminConfig{"", ""},
+		Metrics: MetricsConfig{""},
+		Health:  HealthConfig{""},
+		Upload:  UploadConfig{"allow", []string{}},
+		Hooks: HooksConfig{[]string{}, "", "", []string{}, defaultHookRetries, defaultHookRetryDelay,
+			defaultHookTimeout, defaultHookQueueSize},
+	})
+}
+
+// LoadFile overrides the configuration with the keys of a TOML file
+func (config *FtpConfig) LoadFile(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	values, err := parseToml(string(data))
+	if err != nil {
+		return fmt.Errorf("%v: %v", filename, err)
+	}
+	fields := config.fields()
+	for key, v := range values {
+		field, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("%v: line %v: unknown key %v", filename, v.line, key)
+		}
+		err = setConfigValue(field, v.value)
+		if err != nil {
+			return fmt.Errorf("%v: line %v: %v: %v", filename, v.line, key, err)
+		}
+	}
+	return nil
+}
+
+// LoadEnv overrides the configuration with MYFTP_<SECTION>_<KEY> variables,
+// e.g. MYFTP_ROOT_DIR or MYFTP_PASSIVE_MIN_PORT, arrays are comma separated.
+func (config *FtpConfig) LoadEnv() error {
+	for key := range config.fields() {
+		name := "MYFTP_" + strings.ToUpper(strings.Replace(key, ".", "_", -1))
+		if value, ok := os.LookupEnv(name); ok {
+			err := config.Set(key, value)
+			if err != nil {
+				return fmt.Errorf("%v: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Set overrides the key "section.key" with a value given as text
+func (config *FtpConfig) Set(key string, value string) error {
+	field, ok := config.fields()[key]
+	if !ok {
+		return fmt.Errorf("unknown key %v", key)
+	}
+	var raw interface{} = value
+	switch field.Kind() {
+	case reflect.Slice:
+		items := make([]interface{}, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		raw = items
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", value)
+		}
+		raw = b
+	case reflect.Int:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected an integer, got %q", value)
+		}
+		raw = n
+	}
+	return setConfigValue(field, raw)
+}
+
+// fields maps every "section.key" to its settable field
+func (config *FtpConfig) fields() map[string]reflect.Value {
+	fields := make(map[string]reflect.Value)
+	root := reflect.ValueOf(config).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		name := root.Type().Field(i).Tag.Get("toml")
+		field := root.Field(i)
+		if name == "-" {
+			continue
+		}
+		if field.Kind() != reflect.Struct {
+			fields[name] = field
+			continue
+		}
+		for j := 0; j < field.NumField(); j++ {
+			fields[name+"."+field.Type().Field(j).Tag.Get("toml")] = field.Field(j)
+		}
+	}
+	return fields
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setConfigValue stores a parsed TOML value, durations are written as
+// strings such as "30s" or "5m".
+func setConfigValue(field reflect.Value, raw interface{}) error {
+	switch {
+	case field.Type() == durationType:
+		s, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("expected a duration string such as \"30s\"")
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		s, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("expected a string")
+		}
+		field.SetString(s)
+	case field.Kind() == reflect.Int:
+		n, ok := raw.(int64)
+		if !ok {
+			return fmt.Errorf("expected an integer")
+		}
+		field.SetInt(n)
+	case field.Kind() == reflect.Bool:
+		b, ok := raw.(bool)
+		if !ok {
+			return fmt.Errorf("expected true or false")
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Slice:
+		items, ok := raw.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected an array of strings")
+		}
+		strs := make([]string, 0, len(items))
+		for _, item := range items {
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("expected an array of strings")
+			}
+			strs = append(strs, s)
+		}
+		field.Set(reflect.ValueOf(strs))
+	}
+	return nil
+}
+
+// Validate checks the configuration and resolves it into server settings,
+// every problem found is reported in the error.
+func (config *FtpConfig) Validate() (*FtpServerSettings, error) {
+	settings := &(FtpServerSettings{
+		idleTimeout:      config.Limits.IdleTimeout,
+		loginTimeout:     config.Limits.LoginTimeout,
+		pasvTimeout:      config.Passive.Timeout,
+		transferTimeout:  config.Limits.TransferTimeout,
+		maxLoginAttempts: config.Limits.MaxLoginAttempts,
+		loginFailDelay:   config.Limits.LoginFailDelay,
+		banFailures:      config.Limits.BanFailures,
+		banDuration:      config.Limits.BanDuration,
+		pasvMinPort:      config.Passive.MinPort,
+		pasvMaxPort:      config.Passive.MaxPort,
+		pasvIPMap:        make(map[string]net.IP),
+		proxyProtocol:    config.Proxy.Enabled,
+		proxyTrusted:     &(AccessList{}),
+		authenticator:    config.Authenticator,
+		storage:          config.Storage,
+		accessFile:       config.AccessFile,
+		logFile:          config.Log.File,
+		overwriteDirs:    make(map[string]OverwritePolicy),
+	})
+	problems := make([]string, 0)
+	check := func(key string, err error) {
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%v: %v", key, err))
+		}
+	}
+
+	if len(config.Listen.Addresses) == 0 {
+		check("listen.addresses", fmt.Errorf("at least one address is required"))
+	}
+	for _, addr := range config.Listen.Addresses {
+		check("listen.addresses", validateListenAddr(addr))
+	}
+	settings.listenAddrs = config.Listen.Addresses
+
+	if settings.storage == nil {
+		settings.storage = LocalStorage{}
+	}
+	rootDir, err := filepath.Abs(config.RootDir)
+	check("root_dir", err)
+	if err == nil {
+		fileInfo, err := settings.storage.Stat(rootDir)
+		if err == nil && !fileInfo.IsDir() {
+			err = fmt.Errorf("%v is not a directory", rootDir)
+		}
+		check("root_dir", err)
+	}
+	settings.rootDir = rootDir
+	if settings.authenticator == nil {
+		_, err = CreateAccountListFromFile(config.AccountFile)
+		check("account_file", err)
+		settings.authenticator = &(FileAuthenticator{config.AccountFile})
+	}
+	_, err = CreateAccessListFromFile(config.AccessFile)
+	check("access_file", err)
+	if config.Log.File == "" {
+		check("log.file", fmt.Errorf("a file, stdout or stderr is required"))
+	}
+	if config.Log.Format != "text" && config.Log.Format != "json" {
+		check("log.format", fmt.Errorf("expected text or json, got %q", config.Log.Format))
+	}
+	settings.logFormat = config.Log.Format
+	settings.logLevel, err = ParseLogLevel(config.Log.Level)
+	check("log.level", err)
+	settings.logRotate = rotateOptions("log", config.Log.MaxSizeMB, config.Log.RotateInterval,
+		config.Log.MaxBackups, config.Log.Compress, check)
+	settings.xferLogFile = config.XferLog.File
+	settings.xferLogRotate = rotateOptions("xferlog", config.XferLog.MaxSizeMB, config.XferLog.RotateInterval,
+		config.XferLog.MaxBackups, config.XferLog.Compress, check)
+
+	if config.Passive.MinPort <= 0 || config.Passive.MaxPort > 65535 || config.Passive.MinPort > config.Passive.MaxPort {
+		check("passive.min_port", fmt.Errorf("invalid passive port range [%v, %v]", config.Passive.MinPort, config.Passive.MaxPort))
+	}
+	if config.Passive.Address != "" {
+		settings.pasvIP, err = ResolvePasvIP(config.Passive.Address)
+		check("passive.address", err)
+	}
+	for _, pair := range config.Passive.AddressMap {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || net.ParseIP(strings.TrimSpace(kv[0])) == nil {
+			check("passive.address_map", fmt.Errorf("expected <local ip>=<public address>, got %q", pair))
+			continue
+		}
+		ip, err := ResolvePasvIP(strings.TrimSpace(kv[1]))
+		check("passive.address_map", err)
+		settings.pasvIPMap[net.ParseIP(strings.TrimSpace(kv[0])).String()] = ip
+	}
+
+	durations := map[string]time.Duration{
+		"passive.timeout": config.Passive.Timeout, "limits.idle_timeout": config.Limits.IdleTimeout,
+		"limits.login_timeout": config.Limits.LoginTimeout, "limits.transfer_timeout": config.Limits.TransferTimeout,
+		"limits.login_fail_delay": config.Limits.LoginFailDelay, "limits.ban_duration": config.Limits.BanDuration,
+		"limits.shutdown_grace": config.Limits.ShutdownGrace, "hooks.retry_delay": config.Hooks.RetryDelay,
+		"hooks.timeout": config.Hooks.Timeout,
+	}
+	for key, d := range durations {
+		if d < 0 {
+			check(key, fmt.Errorf("must not be negative"))
+		}
+	}
+	if config.Limits.MaxLoginAttempts < 0 {
+		check("limits.max_login_attempts", fmt.Errorf("must not be negative"))
+	}
+	if config.Limits.BanFailures < 0 {
+		check("limits.ban_failures", fmt.Errorf("must not be negative"))
+	}
+
+	check("proxy.trusted", settings.proxyTrusted.Add(true, strings.Join(config.Proxy.Trusted, ",")))
+	if config.Proxy.Enabled && settings.proxyTrusted.Empty() {
+		check("proxy.trusted", fmt.Errorf("required when proxy.enabled is true"))
+	}
+	if config.Admin.Listen != "" {
+		check("admin.listen", validateListenAddr(config.Admin.Listen))
+		if config.Admin.Token == "" {
+			check("admin.token", fmt.Errorf("required when admin.listen is set"))
+		}
+	}
+	if config.Metrics.Listen != "" {
+		check("metrics.listen", validateListenAddr(config.Metrics.Listen))
+	}
+	if config.Health.Listen != "" {
+		check("health.listen", validateListenAddr(config.Health.Listen))
+	}
+	settings.overwrite, err = ParseOverwritePolicy(config.Upload.Overwrite)
+	check("upload.overwrite", err)
+	for _, pair := range config.Upload.OverwriteDirs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || !strings.HasPrefix(strings.TrimSpace(kv[0]), "/") {
+			check("upload.overwrite_dirs", fmt.Errorf("expected /<dir>=<policy>, got %q", pair))
+			continue
+		}
+		policy, err := ParseOverwritePolicy(strings.TrimSpace(kv[1]))
+		check("upload.overwrite_dirs", err)
+		settings.overwriteDirs[path.Join(rootDir, path.Clean(strings.TrimSpace(kv[0])))] = policy
+	}
+	settings.hooks = HookOptions{Webhooks: config.Hooks.Webhooks, Secret: config.Hooks.Secret, Command: config.Hooks.Command,
+		Events: make(map[string]bool), Retries: config.Hooks.Retries, RetryDelay: config.Hooks.RetryDelay,
+		Timeout: config.Hooks.Timeout, QueueSize: config.Hooks.QueueSize}
+	for _, webhook := range config.Hooks.Webhooks {
+		u, err := url.Parse(webhook)
+		if err == nil && ((u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+			err = fmt.Errorf("expected a http or https URL, got %q", webhook)
+		}
+		check("hooks.webhooks", err)
+	}
+	if config.Hooks.Command != "" {
+		_, err = exec.LookPath(config.Hooks.Command)
+		check("hooks.command", err)
+	}
+	for _, event := range config.Hooks.Events {
+		if !stringIn(event, eventTypes) {
+			check("hooks.events", fmt.Errorf("expected one of %v, got %q", strings.Join(eventTypes, ", "), event))
+		}
+		settings.hooks.Events[event] = true
+	}
+	if config.Hooks.Retries < 0 {
+		check("hooks.retries", fmt.Errorf("must not be negative"))
+	}
+	if config.Hooks.QueueSize <= 0 {
+		check("hooks.queue_size", fmt.Errorf("must be positive"))
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n  %v", strings.Join(problems, "\n  "))
+	}
+	return settings, nil
+}
+
+func stringIn(s string, list []string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func validateListenAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n <= 0 || n > 65535 {
+		return fmt.Errorf("invalid port in %q", addr)
+	}
+	return nil
+}
+
+// rotateOptions checks the rotation keys of a log section
+func rotateOptions(section string, maxSizeMB int, interval time.Duration, maxBackups int, compress bool,
+	check func(string, error)) RotateOptions {
+	if maxSizeMB < 0 {
+		check(section+".max_size_mb", fmt.Errorf("must not be negative"))
+	}
+	if interval < 0 {
+		check(section+".rotate_interval", fmt.Errorf("must not be negative"))
+	}
+	if maxBackups < 0 {
+		check(section+".max_backups", fmt.Errorf("must not be negative"))
+	}
+	return RotateOptions{MaxSize: int64(maxSizeMB) << 20, Interval: interval, MaxBackups: maxBackups, Compress: compress}
+}
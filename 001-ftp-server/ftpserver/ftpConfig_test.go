@@ -0,0 +1,115 @@
+package ftpserver
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigLoadFile(t *testing.T) {
+	name := writeTempFile(t, `# test
+root_dir = "/srv/ftp"
+
+[listen]
+addresses = [":21", "127.0.0.1:2121"]
+
+[passive]
+min_port = 3000 # inline comment
+timeout = "10s"
+
+[proxy]
+enabled = true
+trusted = ["10.0.0.0/8"]
+
+[hooks]
+command = "/opt/hooks/on,event"
+`)
+	defer os.Remove(name)
+	config := DefaultFtpConfig()
+	if err := config.LoadFile(name); err != nil {
+		t.Fatal(err)
+	}
+	if config.RootDir != "/srv/ftp" || config.Passive.MinPort != 3000 || config.Passive.Timeout != 10*time.Second ||
+		!config.Proxy.Enabled || !reflect.DeepEqual(config.Proxy.Trusted, []string{"10.0.0.0/8"}) ||
+		!reflect.DeepEqual(config.Listen.Addresses, []string{":21", "127.0.0.1:2121"}) ||
+		config.Hooks.Command != "/opt/hooks/on,event" {
+		t.Errorf("LoadFile = %+v", config)
+	}
+	if config.Passive.MaxPort != defaultPasvMaxPort || config.Limits.IdleTimeout != defaultIdleTimeout {
+		t.Errorf("LoadFile changed keys missing from the file: %+v", config)
+	}
+
+	for _, content := range []string{
+		"unknown = 1\n",
+		"[passive]\nmin_port = \"3000\"\n",
+		"[passive]\ntimeout = 30\n",
+		"[passive]\ntimeout = \"30 seconds\"\n",
+		"[proxy]\ntrusted = [1, 2]\n",
+		"[hooks]\ncommand = [\"/bin/sh\", \"-c\"]\n",
+		"[passive\n",
+		"root_dir = \"/srv\n",
+	} {
+		bad := writeTempFile(t, content)
+		if err := DefaultFtpConfig().LoadFile(bad); err == nil {
+			t.Errorf("%q accepted", content)
+		}
+		os.Remove(bad)
+	}
+}
+
+func TestConfigLoadEnv(t *testing.T) {
+	os.Setenv("MYFTP_PASSIVE_MAX_PORT", "4000")
+	os.Setenv("MYFTP_LISTEN_ADDRESSES", ":21, :2121,")
+	os.Setenv("MYFTP_LIMITS_IDLE_TIMEOUT", "1m")
+	os.Setenv("MYFTP_PROXY_ENABLED", "true")
+	os.Setenv("MYFTP_HOOKS_COMMAND", "/opt/hooks/on,event")
+	defer func() {
+		for _, name := range []string{"MYFTP_PASSIVE_MAX_PORT", "MYFTP_LISTEN_ADDRESSES", "MYFTP_LIMITS_IDLE_TIMEOUT", "MYFTP_PROXY_ENABLED",
+			"MYFTP_HOOKS_COMMAND"} {
+			os.Unsetenv(name)
+		}
+	}()
+	config := DefaultFtpConfig()
+	if err := config.LoadEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if config.Passive.MaxPort != 4000 || config.Limits.IdleTimeout != time.Minute || !config.Proxy.Enabled ||
+		!reflect.DeepEqual(config.Listen.Addresses, []string{":21", ":2121"}) || config.Hooks.Command != "/opt/hooks/on,event" {
+		t.Errorf("LoadEnv = %+v", config)
+	}
+
+	os.Setenv("MYFTP_PASSIVE_MAX_PORT", "many")
+	if err := DefaultFtpConfig().LoadEnv(); err == nil || !strings.Contains(err.Error(), "MYFTP_PASSIVE_MAX_PORT") {
+		t.Errorf("LoadEnv error = %v, want one naming MYFTP_PASSIVE_MAX_PORT", err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	config, cleanup := createTestConfig(t)
+	defer cleanup()
+	settings, err := config.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.rootDir != config.RootDir || settings.pasvMinPort != defaultPasvMinPort {
+		t.Errorf("Validate = %+v", settings)
+	}
+
+	config.RootDir = config.AccountFile
+	config.Listen.Addresses = []string{"localhost"}
+	config.Passive.MinPort = 3000
+	config.Passive.MaxPort = 2000
+	config.Limits.IdleTimeout = -time.Second
+	config.Proxy.Enabled = true
+	_, err = config.Validate()
+	if err == nil {
+		t.Fatal("Validate accepted an invalid configuration")
+	}
+	for _, key := range []string{"root_dir", "listen.addresses", "passive.min_port", "limits.idle_timeout", "proxy.trusted"} {
+		if !strings.Contains(err.Error(), key+":") {
+			t.Errorf("Validate error does not report %v:\n%v", key, err)
+		}
+	}
+}
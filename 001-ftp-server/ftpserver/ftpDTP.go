@@ -0,0 +1,359 @@
+package ftpserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FtpDTP ...
+type FtpDTP struct {
+	userRootPath string
+	// transferMutex guards transfer which abort closes from other goroutines
+	transferMutex sync.Mutex
+	transfer      Transfer
+	progress      *transferProgress
+	settings      *FtpServerSettings
+	storage       Storage
+	// peerIP is the control connection peer, data connections must come from
+	// it unless allowFXP is set for the account
+	peerIP   net.IP
+	allowFXP bool
+	logger   *FtpLogger
+	metrics  *FtpMetrics
+	// xferLog records RETR and STOR with the user and the transfer type of
+	// the session
+	xferLog *FtpXferLog
+	user    string
+	binary  bool
+	// hooks receive the events of the session, numbered session
+	hooks   *FtpHooks
+	session uint64
+	// umask is the umask of the account for STOR, -1 keeps the mode given
+	// by the storage
+	umask int
+	// charset encodes the names sent in listings
+	charset Charset
+	// bytesSent and bytesReceived count the RETR and STOR bytes of the
+	// session for STAT, atomically
+	bytesSent     int64
+	bytesReceived int64
+}
+
+// CreateFtpDTP ...
+func CreateFtpDTP(settings *FtpServerSettings, session uint64, peerIP net.IP, logger *FtpLogger, xferLog *FtpXferLog,
+	hooks *FtpHooks, metrics *FtpMetrics) (*FtpDTP, error) {
+	return &(FtpDTP{userRootPath: "", transfer: nil, settings: settings, storage: settings.storage, peerIP: peerIP, allowFXP: false,
+		logger: logger, metrics: metrics, xferLog: xferLog, binary: true, umask: -1,
+		charset: utf8Charset{}, hooks: hooks, session: session}), nil
+}
+
+// fireEvent completes event with the session, the user and the client
+// address, and the client path of its file
+func (ftpDTP *FtpDTP) fireEvent(event Event) {
+	if !ftpDTP.hooks.Enabled() {
+		return
+	}
+	event.Time = time.Now()
+	event.Session = ftpDTP.session
+	event.User = ftpDTP.user
+	event.RemoteIP = ftpDTP.peerIP.String()
+	if event.File != "" {
+		event.Path = ftpDTP.clientPath(event.File)
+	}
+	ftpDTP.hooks.Fire(event)
+}
+
+// checksum hashes the bytes of a transfer when the hooks need it, nil
+// otherwise
+func (ftpDTP *FtpDTP) checksum() hash.Hash {
+	if !ftpDTP.hooks.Enabled() {
+		return nil
+	}
+	return sha256.New()
+}
+
+// transferWriter copies to w, progress and sum when it is not nil
+func transferWriter(w io.Writer, progress *transferProgress, sum hash.Hash) io.Writer {
+	if sum == nil {
+		return io.MultiWriter(w, progress)
+	}
+	return io.MultiWriter(w, progress, sum)
+}
+
+// transferProgress describes the running RETR or STOR, path is the file as
+// seen by the client, bytes is updated atomically
+type transferProgress struct {
+	path     string
+	incoming bool
+	size     int64
+	start    time.Time
+	bytes    int64
+}
+
+// Write counts the bytes copied to the data connection or the file
+func (progress *transferProgress) Write(p []byte) (int, error) {
+	atomic.AddInt64(&progress.bytes, int64(len(p)))
+	return len(p), nil
+}
+
+// startProgress publishes the transfer of path to the admin API, size is
+// -1 when unknown. The client path is computed here so that readers of the
+// progress never touch the fields of the DTP set by login.
+func (ftpDTP *FtpDTP) startProgress(path string, incoming bool, size int64) *transferProgress {
+	progress := &(transferProgress{path: ftpDTP.clientPath(path), incoming: incoming, size: size, start: time.Now()})
+	ftpDTP.transferMutex.Lock()
+	ftpDTP.progress = progress
+	ftpDTP.transferMutex.Unlock()
+	return progress
+}
+
+func (ftpDTP *FtpDTP) endProgress() {
+	ftpDTP.transferMutex.Lock()
+	ftpDTP.progress = nil
+	ftpDTP.transferMutex.Unlock()
+}
+
+// logTransfer writes the xferlog line, the metrics and the event of a RETR
+// or STOR which opened its data connection, sum hashed the bytes or is nil
+func (ftpDTP *FtpDTP) logTransfer(path string, incoming bool, start time.Time, bytes int64, sum hash.Hash, err error) {
+	end := time.Now()
+	direction := "sent"
+	if incoming {
+		direction = "received"
+		atomic.AddInt64(&ftpDTP.bytesReceived, bytes)
+	} else {
+		atomic.AddInt64(&ftpDTP.bytesSent, bytes)
+	}
+	ftpDTP.metrics.TransferBytes.Add(uint64(bytes), direction)
+	ftpDTP.metrics.TransferDuration.Observe(end.Sub(start).Seconds(), direction)
+	ftpDTP.xferLog.Log(XferEntry{End: end, Duration: end.Sub(start), RemoteHost: ftpDTP.peerIP.String(), Bytes: bytes,
+		Filename: path, Binary: ftpDTP.binary, Incoming: incoming, User: ftpDTP.user, Complete: err == nil})
+	if err != nil {
+		ftpDTP.transferFailed(path, incoming, bytes, err)
+		return
+	}
+	event := Event{Type: EventDownload, File: path, Size: bytes}
+	if incoming {
+		event.Type = EventUpload
+	}
+	if sum != nil {
+		event.Checksum = hex.EncodeToString(sum.Sum(nil))
+	}
+	ftpDTP.fireEvent(event)
+}
+
+// transferFailed fires the event of a RETR or STOR which failed, possibly
+// before opening its data connection
+func (ftpDTP *FtpDTP) transferFailed(path string, incoming bool, bytes int64, err error) {
+	event := Event{Type: EventDownloadFailed, File: path, Size: bytes, Error: err.Error()}
+	if incoming {
+		event.Type = EventUploadFailed
+	}
+	ftpDTP.fireEvent(event)
+}
+
+// openConn opens the data connection prepared by PASV, the transfer is
+// single use and must be released with closeTransfer afterwards.
+func (ftpDTP *FtpDTP) openConn() (net.Conn, error) {
+	ftpDTP.transferMutex.Lock()
+	transfer := ftpDTP.transfer
+	ftpDTP.transferMutex.Unlock()
+	if transfer == nil {
+		return nil, &DataConnError{fmt.Errorf("no passive port prepared")}
+	}
+	conn, err := transfer.Open()
+	if err != nil {
+		ftpDTP.closeTransfer()
+		return nil, &DataConnError{err}
+	}
+	if ftpDTP.settings.transferTimeout > 0 {
+		conn = &timeoutConn{conn, ftpDTP.settings.transferTimeout}
+	}
+	return conn, nil
+}
+
+func (ftpDTP *FtpDTP) closeTransfer() {
+	ftpDTP.transferMutex.Lock()
+	defer ftpDTP.transferMutex.Unlock()
+	if ftpDTP.transfer != nil {
+		ftpDTP.transfer.Close()
+		ftpDTP.transfer = nil
+	}
+}
+
+// abort closes the data connection under a running transfer, which then
+// fails with a network error.
+func (ftpDTP *FtpDTP) abort() {
+	ftpDTP.transferMutex.Lock()
+	defer ftpDTP.transferMutex.Unlock()
+	if ftpDTP.transfer != nil {
+		ftpDTP.transfer.Close()
+	}
+}
+
+// AbsPath ...
+func (ftpDTP *FtpDTP) AbsPath(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return absPath, nil
+}
+
+// clientPath returns path as seen by the client, below its root
+func (ftpDTP *FtpDTP) clientPath(path string) string {
+	root := ftpDTP.userRootPath
+	if root == "" || !strings.HasPrefix(path, root) {
+		return path
+	}
+	if path = path[len(root):]; path == "" {
+		return "/"
+	}
+	return path
+}
+
+// IsDir ...
+func (ftpDTP *FtpDTP) IsDir(path string) bool {
+	fileInfo, err := ftpDTP.storage.Stat(path)
+	if err != nil {
+		return false
+	}
+	return fileInfo.IsDir()
+}
+
+// ValidPath ...
+func (ftpDTP *FtpDTP) ValidPath(path string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(absPath, ftpDTP.userRootPath) {
+		_, err = ftpDTP.storage.Stat(path)
+		if err != nil {
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+const (
+	dateFormatYear  = "Jan _2  2006"
+	dateFormatTime  = "Jan _2 15:04"
+	dateFormatBound = time.Hour * 24 * 30 * 6
+	dateFormatMLSD  = "20060102150405"
+)
+
+// GetFileInfoString ...
+func (ftpDTP *FtpDTP) GetFileInfoString(file os.FileInfo) string {
+	return fileInfoLine(file, file.Name())
+}
+
+// fileInfoLine is the ls -l line of file listed as name
+func fileInfoLine(file os.FileInfo, name string) string {
+	modTime := file.ModTime()
+	var dateFormat string
+	if time.Now().Sub(modTime) > dateFormatBound {
+		dateFormat = dateFormatYear
+	} else {
+		dateFormat = dateFormatTime
+	}
+
+	return fmt.Sprintf("%s 1 ftp ftp %12d %s %s", file.Mode(), file.Size(), modTime.Format(dateFormat), name)
+}
+
+// SetPassive ...
+func (ftpDTP *FtpDTP) SetPassive() error {
+	ftpDTP.closeTransfer()
+	peerIP := ftpDTP.peerIP
+	if ftpDTP.allowFXP {
+		peerIP = nil
+	}
+	transfer, err := CreatePassiveTransfer(ftpDTP.settings, peerIP, ftpDTP.logger, ftpDTP.metrics)
+	if err != nil {
+		return err
+	}
+	ftpDTP.transferMutex.Lock()
+	ftpDTP.transfer = transfer
+	ftpDTP.transferMutex.Unlock()
+	return nil
+}
+
+// SendFile ...
+func (ftpDTP *FtpDTP) SendFile(path string) error {
+	defer ftpDTP.closeTransfer()
+	file, err := ftpDTP.storage.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	conn, err := ftpDTP.openConn()
+	if err != nil {
+		ftpDTP.transferFailed(path, false, 0, err)
+		return err
+	}
+	// defer conn.Close()
+	start := time.Now()
+	size := int64(-1)
+	if fileInfo, err := ftpDTP.storage.Stat(path); err == nil {
+		size = fileInfo.Size()
+	}
+	progress := ftpDTP.startProgress(path, false, size)
+	defer ftpDTP.endProgress()
+	sum := ftpDTP.checksum()
+	n, err := io.Copy(transferWriter(conn, progress, sum), file)
+	if err == io.EOF {
+		err = nil
+	}
+	ftpDTP.logTransfer(path, false, start, n, sum, err)
+	return err
+}
+
+// receiveTo writes the data connection to file, created at path, or opened
+// once the connection is open when file is nil. A file reserved for the
+// upload is removed when no data arrives, so that the name stays free.
+func (ftpDTP *FtpDTP) receiveTo(path string, file io.WriteCloser, reserved bool) error {
+	defer ftpDTP.closeTransfer()
+	conn, err := ftpDTP.openConn()
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		ftpDTP.discardUpload(path, reserved)
+		ftpDTP.transferFailed(path, true, 0, err)
+		return err
+	}
+	if file == nil {
+		if file, err = ftpDTP.openUpload(path); err != nil {
+			ftpDTP.transferFailed(path, true, 0, err)
+			return err
+		}
+	}
+	// defer conn.Close()
+	start := time.Now()
+	progress := ftpDTP.startProgress(path, true, -1)
+	defer ftpDTP.endProgress()
+	sum := ftpDTP.checksum()
+	n, err := io.Copy(transferWriter(file, progress, sum), conn)
+	if err != nil && err != io.EOF {
+		file.Close()
+		if n == 0 {
+			ftpDTP.discardUpload(path, reserved)
+		}
+		ftpDTP.logTransfer(path, true, start, n, sum, err)
+		return err
+	}
+	err = file.Close()
+	ftpDTP.logTransfer(path, true, start, n, sum, err)
+	return err
+}
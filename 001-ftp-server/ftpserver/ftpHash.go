@@ -0,0 +1,282 @@
+package ftpserver
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// hashAlgorithms are the algorithms of HASH, in the order FEAT lists them
+var hashAlgorithms = []string{"SHA-1", "SHA-256", "SHA-512", "MD5", "CRC32"}
+
+const defaultHashAlgorithm = "SHA-256"
+
+func newHash(algorithm string) (hash.Hash, bool) {
+	switch algorithm {
+	case "SHA-1":
+		return sha1.New(), true
+	case "SHA-256":
+		return sha256.New(), true
+	case "SHA-512":
+		return sha512.New(), true
+	case "MD5":
+		return md5.New(), true
+	case "CRC32":
+		return crc32.NewIEEE(), true
+	}
+	return nil, false
+}
+
+// HashFile streams length bytes of path from start, -1 meaning up to the
+// end of the file, through the algorithm and returns the hex digest and
+// the number of bytes hashed
+func (ftpDTP *FtpDTP) HashFile(path string, algorithm string, start int64, length int64) (string, int64, error) {
+	return ftpDTP.hashFile(path, algorithm, start, length, nil)
+}
+
+// errHashAborted stops a hash once ABOR aborted it
+var errHashAborted = fmt.Errorf("hash aborted")
+
+// abortReader fails once aborted reports true
+type abortReader struct {
+	reader  io.Reader
+	aborted func() bool
+}
+
+func (r abortReader) Read(p []byte) (int, error) {
+	if r.aborted() {
+		return 0, errHashAborted
+	}
+	return r.reader.Read(p)
+}
+
+// hashFile is HashFile stopping with errHashAborted once aborted, when not
+// nil, reports true
+func (ftpDTP *FtpDTP) hashFile(path string, algorithm string, start int64, length int64, aborted func() bool) (string, int64, error) {
+	h, ok := newHash(algorithm)
+	if !ok {
+		return "", 0, fmt.Errorf("unknown hash algorithm %v", algorithm)
+	}
+	file, err := ftpDTP.storage.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if aborted != nil {
+		reader = abortReader{file, aborted}
+	}
+	if seeker, ok := file.(io.Seeker); ok {
+		_, err = seeker.Seek(start, io.SeekStart)
+	} else {
+		_, err = io.CopyN(ioutil.Discard, reader, start)
+	}
+	if err != nil && err != io.EOF {
+		return "", 0, err
+	}
+	if length >= 0 {
+		reader = io.LimitReader(reader, length)
+	}
+	n, err := io.Copy(h, reader)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// runHash hashes a file in the background like a transfer, so that a
+// large file does not hold up the control connection and ABOR stops it.
+// reply writes the result and returns its code.
+func (ftpPI *FtpPI) runHash(path string, algorithm string, start int64, length int64, reply func(digest string, n int64) int) {
+	ftpPI.runBackground(func() int {
+		digest, n, err := ftpPI.dtp.hashFile(path, algorithm, start, length, ftpPI.isAborted)
+		switch {
+		case err == errHashAborted:
+			ftpPI.writeMsgCode(426)
+			ftpPI.dtp.logger.Info("hash aborted")
+			return 426
+		case err != nil:
+			ftpPI.writeMsg(450, "Cannot read the file.")
+			ftpPI.dtp.logger.Warn("cannot hash file", F("error", err))
+			return 450
+		}
+		return reply(digest, n)
+	})
+}
+
+// hashFeature is the FEAT line of HASH, the selected algorithm is starred
+func (ftpPI *FtpPI) hashFeature() string {
+	names := make([]string, len(hashAlgorithms))
+	for i, name := range hashAlgorithms {
+		names[i] = name
+		if name == ftpPI.hashAlgorithm {
+			names[i] += "*"
+		}
+	}
+	return "HASH " + strings.Join(names, ";")
+}
+
+// resolvePath turns a client path into a path of the storage, like the
+// transfer commands do
+func (ftpPI *FtpPI) resolvePath(para string) string {
+	if para == "" {
+		return ftpPI.curPath
+	} else if para[0] == '/' {
+		return ftpPI.dtp.userRootPath + para
+	}
+	return ftpPI.curPath + "/" + para
+}
+
+// filePath resolves the argument of a command naming an existing file,
+// otherwise it replies 550
+func (ftpPI *FtpPI) filePath(para string) (string, error) {
+	path := ftpPI.resolvePath(para)
+	if para == "" || !ftpPI.dtp.ValidPath(path) || ftpPI.dtp.IsDir(path) {
+		ftpPI.writeMsg(550, "File not found.")
+		return "", fmt.Errorf("invalid path %v", path)
+	}
+	return path, nil
+}
+
+// HandleOPTSHASH shows or selects the algorithm of HASH
+func (ftpPI *FtpPI) HandleOPTSHASH(algorithm string) error {
+	if algorithm == "" {
+		ftpPI.writeMsg(200, ftpPI.hashAlgorithm)
+		return nil
+	}
+	algorithm = strings.ToUpper(algorithm)
+	if _, ok := newHash(algorithm); !ok {
+		ftpPI.writeMsg(501, "Unknown algorithm, current selection not changed.")
+		return fmt.Errorf("unknown hash algorithm %v", algorithm)
+	}
+	ftpPI.hashAlgorithm = algorithm
+	ftpPI.writeMsg(200, algorithm)
+	return nil
+}
+
+// HandleRANG sets the byte range of the next HASH, "RANG 1 0" resets it
+func (ftpPI *FtpPI) HandleRANG() error {
+	fields := strings.Fields(ftpPI.para)
+	if len(fields) != 2 {
+		ftpPI.writeMsgCode(501)
+		return fmt.Errorf("invalid range %q", ftpPI.para)
+	}
+	start, err1 := strconv.ParseInt(fields[0], 10, 64)
+	end, err2 := strconv.ParseInt(fields[1], 10, 64)
+	if err1 != nil || err2 != nil || start < 0 || end < 0 {
+		ftpPI.writeMsgCode(501)
+		return fmt.Errorf("invalid range %q", ftpPI.para)
+	}
+	if start == 1 && end == 0 {
+		ftpPI.rangeStart, ftpPI.rangeEnd = 0, -1
+		ftpPI.writeMsg(350, "Restarting at 0. Ending at EOF.")
+		return nil
+	}
+	if start > end {
+		ftpPI.writeMsgCode(501)
+		return fmt.Errorf("invalid range %q", ftpPI.para)
+	}
+	ftpPI.rangeStart, ftpPI.rangeEnd = start, end
+	ftpPI.writeMsg(350, fmt.Sprintf("Restarting at %v. Ending at %v.", start, end))
+	return nil
+}
+
+// HandleHASH replies "213 <algorithm> <start>-<end> <digest> <file>" for
+// the range set by RANG, which is then reset
+func (ftpPI *FtpPI) HandleHASH() error {
+	start, end := ftpPI.rangeStart, ftpPI.rangeEnd
+	ftpPI.rangeStart, ftpPI.rangeEnd = 0, -1
+	path, err := ftpPI.filePath(ftpPI.para)
+	if err != nil {
+		return err
+	}
+	length := int64(-1)
+	if end >= 0 {
+		length = end - start + 1
+	}
+	// the reply is built once the command returned, from its own copies
+	algorithm, name := ftpPI.hashAlgorithm, ftpPI.para
+	ftpPI.runHash(path, algorithm, start, length, func(digest string, n int64) int {
+		last := start + n - 1
+		if n == 0 {
+			last = start
+		}
+		ftpPI.writeMsg(213, fmt.Sprintf("%v %v-%v %v %v", algorithm, start, last, digest, name))
+		return 213
+	})
+	return nil
+}
+
+// HandleXHASH answers XCRC, XMD5, XSHA1 and XSHA256, whose argument is a
+// file, quoted when it has spaces, optionally followed by a start and an
+// end offset
+func (ftpPI *FtpPI) HandleXHASH(algorithm string) error {
+	name, start, end, err := parseXHashArgs(ftpPI.para)
+	if err != nil {
+		ftpPI.writeMsgCode(501)
+		return err
+	}
+	path, err := ftpPI.filePath(name)
+	if err != nil {
+		return err
+	}
+	// unlike RANG, the end offset of the X commands is exclusive
+	length := int64(-1)
+	if end >= 0 {
+		length = end - start
+	}
+	ftpPI.runHash(path, algorithm, start, length, func(digest string, n int64) int {
+		ftpPI.writeMsg(250, strings.ToUpper(digest))
+		return 250
+	})
+	return nil
+}
+
+// parseXHashArgs splits `"name" [start [end]]`, an unquoted name takes the
+// whole argument unless it is followed by numbers
+func parseXHashArgs(para string) (string, int64, int64, error) {
+	var name, rest string
+	if strings.HasPrefix(para, "\"") {
+		idx := strings.Index(para[1:], "\"")
+		if idx < 0 {
+			return "", 0, 0, fmt.Errorf("unterminated quote in %q", para)
+		}
+		name, rest = para[1:idx+1], para[idx+2:]
+	} else {
+		fields := strings.Fields(para)
+		numbers := 0
+		for i := len(fields) - 1; i > 0 && numbers < 2; i-- {
+			if _, err := strconv.ParseInt(fields[i], 10, 64); err != nil {
+				break
+			}
+			numbers++
+		}
+		name = strings.Join(fields[:len(fields)-numbers], " ")
+		rest = strings.Join(fields[len(fields)-numbers:], " ")
+	}
+	start, end := int64(0), int64(-1)
+	fields := strings.Fields(rest)
+	var err error
+	if len(fields) > 2 {
+		return "", 0, 0, fmt.Errorf("too many arguments in %q", para)
+	}
+	if len(fields) >= 1 {
+		start, err = strconv.ParseInt(fields[0], 10, 64)
+	}
+	if err == nil && len(fields) == 2 {
+		end, err = strconv.ParseInt(fields[1], 10, 64)
+	}
+	if err != nil || start < 0 || (end >= 0 && end < start) {
+		return "", 0, 0, fmt.Errorf("invalid range in %q", para)
+	}
+	return name, start, end, nil
+}
@@ -0,0 +1,131 @@
+package ftpserver
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseXHashArgs(t *testing.T) {
+	tests := []struct {
+		para  string
+		name  string
+		start int64
+		end   int64
+		err   bool
+	}{
+		{"hello.txt", "hello.txt", 0, -1, false},
+		{"hello.txt 2", "hello.txt", 2, -1, false},
+		{"hello.txt 2 4", "hello.txt", 2, 4, false},
+		{"my file.txt", "my file.txt", 0, -1, false},
+		{"my file.txt 1 3", "my file.txt", 1, 3, false},
+		{"\"my file 2\" 1 3", "my file 2", 1, 3, false},
+		{"2019 report", "2019 report", 0, -1, false},
+		{"\"unterminated 1", "", 0, 0, true},
+		{"\"a\" 1 2 3", "", 0, 0, true},
+		{"hello.txt 4 2", "", 0, 0, true},
+		{"\"a\" x", "", 0, 0, true},
+	}
+	for _, test := range tests {
+		name, start, end, err := parseXHashArgs(test.para)
+		if (err != nil) != test.err {
+			t.Errorf("parseXHashArgs(%q) error = %v, want error %v", test.para, err, test.err)
+			continue
+		}
+		if !test.err && (name != test.name || start != test.start || end != test.end) {
+			t.Errorf("parseXHashArgs(%q) = %q, %v, %v, want %q, %v, %v", test.para, name, start, end, test.name, test.start, test.end)
+		}
+	}
+}
+
+func TestHASH(t *testing.T) {
+	_, addr, cleanup := startTestServer(t, nil)
+	defer cleanup()
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.cmd("HASH hello.txt", 530)
+	client.login()
+	content := []byte("hello\n")
+	sha256Sum := sha256.Sum256(content)
+	if reply := client.cmd("HASH hello.txt", 213); reply != "213 SHA-256 0-5 "+hex.EncodeToString(sha256Sum[:])+" hello.txt" {
+		t.Errorf("HASH = %q", reply)
+	}
+	client.cmd("OPTS HASH", 200)
+	client.cmd("OPTS HASH whirlpool", 501)
+	client.cmd("OPTS HASH md5", 200)
+	client.cmd("RANG 1 3", 350)
+	md5Sum := md5.Sum(content[1:4])
+	if reply := client.cmd("HASH hello.txt", 213); reply != "213 MD5 1-3 "+hex.EncodeToString(md5Sum[:])+" hello.txt" {
+		t.Errorf("HASH with RANG = %q", reply)
+	}
+	md5Sum = md5.Sum(content)
+	if reply := client.cmd("HASH /hello.txt", 213); !strings.HasPrefix(reply, "213 MD5 0-5 "+hex.EncodeToString(md5Sum[:])) {
+		t.Errorf("HASH after RANG was reset = %q", reply)
+	}
+	client.cmd("RANG 3 1", 501)
+	client.cmd("RANG x", 501)
+	client.cmd("HASH missing.txt", 550)
+	client.cmd("HASH /", 550)
+
+	sha1Sum := sha1.Sum(content[2:4])
+	for _, test := range []struct {
+		command string
+		digest  string
+	}{
+		{"XCRC hello.txt", fmt.Sprintf("%08X", crc32.ChecksumIEEE(content))},
+		{"XMD5 hello.txt", strings.ToUpper(hex.EncodeToString(md5Sum[:]))},
+		{"XSHA1 \"hello.txt\" 2 4", strings.ToUpper(hex.EncodeToString(sha1Sum[:]))},
+		{"XSHA256 hello.txt", strings.ToUpper(hex.EncodeToString(sha256Sum[:]))},
+	} {
+		if reply := client.cmd(test.command, 250); reply != "250 "+test.digest {
+			t.Errorf("%v = %q, want %v", test.command, reply, test.digest)
+		}
+	}
+	client.cmd("XMD5 hello.txt 4 2", 501)
+	client.cmd("XMD5 missing.txt", 550)
+}
+
+// endlessStorage serves every file as an endless stream of zeros
+type endlessStorage struct {
+	LocalStorage
+}
+
+type endlessReader struct{}
+
+func (endlessReader) Read(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func (endlessStorage) Open(path string) (io.ReadCloser, error) {
+	return ioutil.NopCloser(endlessReader{}), nil
+}
+
+func TestHASHAbort(t *testing.T) {
+	_, addr, cleanup := startTestServer(t, func(config *FtpConfig) {
+		config.Storage = endlessStorage{}
+	})
+	defer cleanup()
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.login()
+	for _, command := range []string{"HASH hello.txt", "XSHA256 hello.txt"} {
+		fmt.Fprintf(client.conn, "%v\r\n", command)
+		client.cmd("NOOP", 200)
+		client.cmd("CWD /", 503)
+		client.cmd("ABOR", 426)
+		client.expect(226)
+	}
+	client.cmd("QUIT", 221)
+}
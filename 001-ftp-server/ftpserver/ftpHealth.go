@@ -0,0 +1,89 @@
+package ftpserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ReadyChecker is implemented by an Authenticator which can tell whether
+// its account store is usable, /readyz calls it
+type ReadyChecker interface {
+	Ready() error
+}
+
+// WritableChecker is implemented by a Storage which can tell whether new
+// files can be created in a directory, /readyz calls it on the root
+type WritableChecker interface {
+	CheckWritable(dir string) error
+}
+
+// Healthy reports whether the server is alive: at least one accept loop
+// runs, or the server is draining and should be left to finish.
+func (ftpServer *FtpServer) Healthy() error {
+	ftpServer.mutex.Lock()
+	defer ftpServer.mutex.Unlock()
+	if ftpServer.serving == 0 && !ftpServer.draining {
+		return fmt.Errorf("no accept loop running")
+	}
+	return nil
+}
+
+// Ready reports every reason the server should not get new clients
+func (ftpServer *FtpServer) Ready() error {
+	problems := make([]string, 0)
+	if err := ftpServer.Healthy(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if ftpServer.isDraining() {
+		problems = append(problems, "server is shutting down")
+	}
+	settings := ftpServer.settings
+	if checker, ok := settings.authenticator.(ReadyChecker); ok {
+		if err := checker.Ready(); err != nil {
+			problems = append(problems, fmt.Sprintf("account store: %v", err))
+		}
+	}
+	fileInfo, err := settings.storage.Stat(settings.rootDir)
+	if err == nil && !fileInfo.IsDir() {
+		err = fmt.Errorf("%v is not a directory", settings.rootDir)
+	}
+	if err == nil {
+		if checker, ok := settings.storage.(WritableChecker); ok {
+			err = checker.CheckWritable(settings.rootDir)
+		}
+	}
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("root directory: %v", err))
+	}
+	if inUse := ftpServer.metrics.PassivePortsInUse.Value(); inUse >= int64(settings.pasvMaxPort-settings.pasvMinPort+1) {
+		problems = append(problems, fmt.Sprintf("all %v passive ports in use", inUse))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%v", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// HealthHandler serves /healthz from Healthy and /readyz from Ready, with
+// 200 or 503 and the reasons as text
+func (ftpServer *FtpServer) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, ftpServer.Healthy())
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, ftpServer.Ready())
+	})
+	return mux
+}
+
+func writeHealth(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, err)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
@@ -0,0 +1,60 @@
+package ftpserver
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// probe returns the status and body of a health endpoint
+func probe(ftpServer *FtpServer, path string) (int, string) {
+	recorder := httptest.NewRecorder()
+	ftpServer.HealthHandler().ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+	return recorder.Code, recorder.Body.String()
+}
+
+func TestHealthBeforeServe(t *testing.T) {
+	config, cleanup := createTestConfig(t)
+	defer cleanup()
+	ftpServer, err := CreateFtpServer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ftpServer.Shutdown(context.Background())
+	if code, body := probe(ftpServer, "/healthz"); code != 503 || !strings.Contains(body, "no accept loop running") {
+		t.Errorf("/healthz = %v %q, want 503 without accept loop", code, body)
+	}
+}
+
+func TestHealthReady(t *testing.T) {
+	ftpServer, addr, cleanup := startTestServer(t, nil)
+	defer cleanup()
+	// the greeting shows the accept loop runs
+	dialTestClient(t, addr).conn.Close()
+	for _, path := range []string{"/healthz", "/readyz"} {
+		if code, body := probe(ftpServer, path); code != 200 || body != "ok\n" {
+			t.Errorf("%v = %v %q, want 200 ok", path, code, body)
+		}
+	}
+
+	os.RemoveAll(ftpServer.settings.rootDir)
+	if code, body := probe(ftpServer, "/readyz"); code != 503 || !strings.Contains(body, "root directory:") {
+		t.Errorf("/readyz = %v %q, want 503 for the missing root", code, body)
+	}
+	os.Mkdir(ftpServer.settings.rootDir, 0777)
+	ftpServer.metrics.PassivePortsInUse.Add(int64(ftpServer.settings.pasvMaxPort - ftpServer.settings.pasvMinPort + 1))
+	if code, body := probe(ftpServer, "/readyz"); code != 503 || !strings.Contains(body, "passive ports in use") {
+		t.Errorf("/readyz = %v %q, want 503 with every passive port in use", code, body)
+	}
+	ftpServer.metrics.PassivePortsInUse.Add(-int64(ftpServer.settings.pasvMaxPort - ftpServer.settings.pasvMinPort + 1))
+
+	ftpServer.Shutdown(context.Background())
+	if code, body := probe(ftpServer, "/readyz"); code != 503 || !strings.Contains(body, "server is shutting down") {
+		t.Errorf("/readyz = %v %q, want 503 while draining", code, body)
+	}
+	if code, _ := probe(ftpServer, "/healthz"); code != 200 {
+		t.Errorf("/healthz = %v while draining, want 200", code)
+	}
+}
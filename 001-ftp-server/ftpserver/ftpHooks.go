@@ -0,0 +1,280 @@
+package ftpserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Event types, a command changing files fires its own type
+const (
+	EventLogin          = "login"
+	EventLogout         = "logout"
+	EventUpload         = "upload"
+	EventDownload       = "download"
+	EventUploadFailed   = "upload_failed"
+	EventDownloadFailed = "download_failed"
+	EventChmod          = "chmod"
+	EventSetTime        = "set_time"
+)
+
+// eventTypes are the types accepted by hooks.events
+var eventTypes = []string{EventLogin, EventLogout, EventUpload, EventDownload, EventUploadFailed,
+	EventDownloadFailed, EventChmod, EventSetTime}
+
+// maxHookOutput bounds the webhook response body read and the command
+// output kept for the log
+const maxHookOutput = 4096
+
+// Event is delivered to the hooks as JSON
+type Event struct {
+	Type     string    `json:"event"`
+	Time     time.Time `json:"timestamp"`
+	Session  uint64    `json:"session"`
+	User     string    `json:"user,omitempty"`
+	RemoteIP string    `json:"remote_ip"`
+	// Path is seen by the client, File is the path in the storage
+	Path string `json:"path,omitempty"`
+	File string `json:"file,omitempty"`
+	// Size is the number of bytes transferred, Checksum their SHA-256 once
+	// the transfer completed
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HookOptions configures the delivery of events
+type HookOptions struct {
+	// Webhooks receive every event as a JSON POST, signed with Secret in the
+	// X-MyFTP-Signature header when it is set
+	Webhooks []string
+	Secret   string
+	// Command runs for every event with the JSON on its standard input and
+	// the fields in MYFTP_EVENT_* variables, it is the path of the program
+	Command string
+	// Events selects the event types, all of them when empty
+	Events map[string]bool
+	// a failed delivery is tried Retries more times, waiting RetryDelay
+	// then twice as long each time, Timeout bounds every attempt
+	Retries    int
+	RetryDelay time.Duration
+	Timeout    time.Duration
+	// QueueSize events wait per hook, further events are dropped
+	QueueSize int
+}
+
+// FtpHooks delivers events to webhooks and a local command in the
+// background, each hook in order. A nil FtpHooks delivers nothing.
+type FtpHooks struct {
+	options HookOptions
+	logger  *FtpLogger
+	metrics *FtpMetrics
+	// mutex guards closed, set by Close once the queues are closed
+	mutex   sync.RWMutex
+	closed  bool
+	sinks   []*hookSink
+	workers sync.WaitGroup
+}
+
+// hookSink is a webhook or the command, with its own queue and worker
+type hookSink struct {
+	kind    string
+	name    string
+	queue   chan hookJob
+	deliver func(job hookJob) error
+}
+
+type hookJob struct {
+	event Event
+	body  []byte
+}
+
+// CreateFtpHooks starts a worker per hook, it returns nil when no hook is
+// configured
+func CreateFtpHooks(options HookOptions, logger *FtpLogger, metrics *FtpMetrics) *FtpHooks {
+	if len(options.Webhooks) == 0 && options.Command == "" {
+		return nil
+	}
+	hooks := &(FtpHooks{options: options, logger: logger, metrics: metrics})
+	client := &(http.Client{Timeout: options.Timeout})
+	for _, url := range options.Webhooks {
+		url := url
+		hooks.sinks = append(hooks.sinks, &(hookSink{kind: "webhook", name: url,
+			deliver: func(job hookJob) error { return hooks.post(client, url, job) }}))
+	}
+	if options.Command != "" {
+		hooks.sinks = append(hooks.sinks, &(hookSink{kind: "command", name: options.Command, deliver: hooks.run}))
+	}
+	for _, sink := range hooks.sinks {
+		sink.queue = make(chan hookJob, options.QueueSize)
+		hooks.workers.Add(1)
+		go hooks.work(sink)
+	}
+	return hooks
+}
+
+// Fire queues event for every hook without waiting, it is dropped when a
+// queue is full or the hooks are closed
+func (hooks *FtpHooks) Fire(event Event) {
+	if hooks == nil || (len(hooks.options.Events) > 0 && !hooks.options.Events[event.Type]) {
+		return
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		hooks.logger.Error("cannot encode event", F("event", event.Type), F("error", err))
+		return
+	}
+	hooks.mutex.RLock()
+	defer hooks.mutex.RUnlock()
+	for _, sink := range hooks.sinks {
+		if hooks.closed {
+			hooks.drop(sink, event, "hooks closed")
+			continue
+		}
+		select {
+		case sink.queue <- hookJob{event, body}:
+		default:
+			hooks.drop(sink, event, "queue full")
+		}
+	}
+}
+
+func (hooks *FtpHooks) drop(sink *hookSink, event Event, reason string) {
+	hooks.metrics.HookDeliveries.Inc(sink.kind, "dropped")
+	hooks.logger.Warn("event dropped", F("hook", sink.name), F("event", event.Type), F("reason", reason))
+}
+
+// Enabled reports whether events are delivered, transfers compute their
+// checksum only then
+func (hooks *FtpHooks) Enabled() bool {
+	return hooks != nil
+}
+
+// work delivers the events of a hook one after the other
+func (hooks *FtpHooks) work(sink *hookSink) {
+	defer hooks.workers.Done()
+	for job := range sink.queue {
+		delay := hooks.options.RetryDelay
+		var err error
+		for attempt := 0; attempt <= hooks.options.Retries; attempt++ {
+			if attempt > 0 {
+				time.Sleep(delay)
+				delay *= 2
+			}
+			if err = sink.deliver(job); err == nil {
+				break
+			}
+			hooks.logger.Debug("event delivery failed", F("hook", sink.name), F("event", job.event.Type),
+				F("attempt", attempt+1), F("error", err))
+		}
+		if err != nil {
+			hooks.metrics.HookDeliveries.Inc(sink.kind, "failed")
+			hooks.logger.Error("cannot deliver event", F("hook", sink.name), F("event", job.event.Type),
+				F("attempts", hooks.options.Retries+1), F("error", err))
+			continue
+		}
+		hooks.metrics.HookDeliveries.Inc(sink.kind, "delivered")
+	}
+}
+
+// post sends the event to a webhook, any answer but 2xx is a failure
+func (hooks *FtpHooks) post(client *http.Client, url string, job hookJob) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(job.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "myftp")
+	if hooks.options.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(hooks.options.Secret))
+		mac.Write(job.body)
+		req.Header.Set("X-MyFTP-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxHookOutput))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook answered %v", resp.Status)
+	}
+	return nil
+}
+
+// run executes the command, a non zero exit status is a failure
+func (hooks *FtpHooks) run(job hookJob) error {
+	ctx := context.Background()
+	if hooks.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hooks.options.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, hooks.options.Command)
+	cmd.Env = append(os.Environ(), eventEnv(job.event)...)
+	cmd.Stdin = bytes.NewReader(job.body)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if len(output) > maxHookOutput {
+			output = output[:maxHookOutput]
+		}
+		return fmt.Errorf("%v: %q", err, output)
+	}
+	return nil
+}
+
+// eventEnv are the MYFTP_EVENT_* variables of the command
+func eventEnv(event Event) []string {
+	return []string{
+		"MYFTP_EVENT=" + event.Type,
+		"MYFTP_EVENT_TIME=" + event.Time.UTC().Format(time.RFC3339),
+		"MYFTP_EVENT_SESSION=" + strconv.FormatUint(event.Session, 10),
+		"MYFTP_EVENT_USER=" + event.User,
+		"MYFTP_EVENT_REMOTE_IP=" + event.RemoteIP,
+		"MYFTP_EVENT_PATH=" + event.Path,
+		"MYFTP_EVENT_FILE=" + event.File,
+		"MYFTP_EVENT_SIZE=" + strconv.FormatInt(event.Size, 10),
+		"MYFTP_EVENT_CHECKSUM=" + event.Checksum,
+		"MYFTP_EVENT_ERROR=" + event.Error,
+	}
+}
+
+// Close stops accepting events and waits until the queued ones are
+// delivered, or ctx is done and they are lost
+func (hooks *FtpHooks) Close(ctx context.Context) error {
+	if hooks == nil {
+		return nil
+	}
+	hooks.mutex.Lock()
+	if !hooks.closed {
+		hooks.closed = true
+		for _, sink := range hooks.sinks {
+			close(sink.queue)
+		}
+	}
+	hooks.mutex.Unlock()
+	done := make(chan struct{})
+	go func() {
+		hooks.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		hooks.logger.Warn("hooks closed before every event was delivered")
+		return ctx.Err()
+	}
+}
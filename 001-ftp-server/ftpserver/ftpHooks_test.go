@@ -0,0 +1,160 @@
+package ftpserver
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// webhookServer decodes the events posted to it and checks their
+// signature, failing the first fail requests with 500
+func webhookServer(t *testing.T, secret string, fail int32) (*httptest.Server, chan Event) {
+	events := make(chan Event, 16)
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(&requests, 1) <= fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		want := ""
+		if secret != "" {
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write(body)
+			want = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		}
+		if got := r.Header.Get("X-MyFTP-Signature"); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		var event Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("cannot decode %q: %v", body, err)
+		}
+		events <- event
+	}))
+	return server, events
+}
+
+func waitEvent(t *testing.T, events chan Event, eventType string) Event {
+	select {
+	case event := <-events:
+		if event.Type != eventType {
+			t.Fatalf("got event %+v, want %v", event, eventType)
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no %v event", eventType)
+	}
+	return Event{}
+}
+
+func TestHooksWebhook(t *testing.T) {
+	webhook, events := webhookServer(t, "s3cret", 0)
+	defer webhook.Close()
+	ftpServer, addr, cleanup := startTestServer(t, func(config *FtpConfig) {
+		config.Hooks.Webhooks = []string{webhook.URL}
+		config.Hooks.Secret = "s3cret"
+	})
+	defer cleanup()
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.login()
+	if event := waitEvent(t, events, EventLogin); event.User != "ABC" || event.RemoteIP != "127.0.0.1" || event.Session == 0 {
+		t.Errorf("login event = %+v", event)
+	}
+	client.retr("hello.txt")
+	sum := sha256.Sum256([]byte("hello\n"))
+	if event := waitEvent(t, events, EventDownload); event.Path != "/hello.txt" || event.Size != 6 ||
+		event.Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("download event = %+v", event)
+	}
+	client.pasv()
+	client.cmd("RETR hello.txt", 150)
+	client.cmd("ABOR", 426)
+	client.expect(226)
+	if event := waitEvent(t, events, EventDownloadFailed); event.Error == "" {
+		t.Errorf("download_failed event = %+v, want an error", event)
+	}
+	client.cmd("QUIT", 221)
+	waitEvent(t, events, EventLogout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ftpServer.Shutdown(ctx)
+}
+
+func TestHooksRetry(t *testing.T) {
+	webhook, events := webhookServer(t, "", 2)
+	defer webhook.Close()
+	logger, cleanup := createTestLogger(t)
+	defer cleanup()
+	metrics := CreateFtpMetrics()
+	hooks := CreateFtpHooks(HookOptions{Webhooks: []string{webhook.URL}, Events: map[string]bool{EventUpload: true},
+		Retries: 2, RetryDelay: time.Millisecond, Timeout: time.Second, QueueSize: 4}, logger, metrics)
+	hooks.Fire(Event{Type: EventLogin})
+	hooks.Fire(Event{Type: EventUpload, File: "/a.txt"})
+	if err := hooks.Close(context.Background()); err != nil {
+		t.Fatalf("Close = %v", err)
+	}
+	if event := waitEvent(t, events, EventUpload); event.File != "/a.txt" {
+		t.Errorf("upload event = %+v", event)
+	}
+	if len(events) != 0 {
+		t.Errorf("the login event was delivered, hooks.events only has upload")
+	}
+	hooks.Fire(Event{Type: EventUpload})
+	if got := scrape(metrics); !strings.Contains(got, `myftp_hook_deliveries_total{hook="webhook",result="delivered"} 1`) ||
+		!strings.Contains(got, `myftp_hook_deliveries_total{hook="webhook",result="dropped"} 1`) {
+		t.Errorf("metrics = %v, want a delivered and a dropped event", got)
+	}
+	if CreateFtpHooks(HookOptions{}, nil, nil).Enabled() {
+		t.Errorf("hooks without webhook or command are enabled")
+	}
+}
+
+func TestHooksCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook is a shell script")
+	}
+	dir, cleanupDir := createTempDir(t)
+	defer cleanupDir()
+	out := filepath.Join(dir, "out")
+	// the path is never split, even at a comma
+	script := filepath.Join(dir, "on,event.sh")
+	ioutil.WriteFile(script, []byte("#!/bin/sh\n{ echo \"$MYFTP_EVENT $MYFTP_EVENT_USER $MYFTP_EVENT_SIZE\"; cat; } >>"+out+"\n"), 0755)
+
+	ftpServer, addr, cleanup := startTestServer(t, func(config *FtpConfig) {
+		config.Hooks.Command = script
+		config.Hooks.Events = []string{EventUpload}
+	})
+	defer cleanup()
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.login()
+	client.stor("up.txt", "upload")
+	client.cmd("QUIT", 221)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ftpServer.Shutdown(ctx)
+
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitN(string(data), "\n", 2)
+	var event Event
+	if lines[0] != "upload ABC 6" || json.Unmarshal([]byte(lines[1]), &event) != nil || event.Path != "/up.txt" {
+		t.Errorf("the command got %q", data)
+	}
+}
@@ -0,0 +1,239 @@
+package ftpserver
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ListOptions are the ls flags understood by LIST and NLST
+type ListOptions struct {
+	// All shows the files whose name starts with a dot
+	All bool
+	// Long lists mode, size and time, it is always set for LIST
+	Long bool
+	// Recursive lists the subdirectories too
+	Recursive bool
+	// SortTime sorts the newest first instead of by name
+	SortTime bool
+}
+
+// listEntry is a file listed under name, its path relative to the listing
+type listEntry struct {
+	name string
+	info os.FileInfo
+}
+
+// parseListArgs splits the leading flags such as "-la" from the path,
+// unknown flags are ignored as clients send many ls options
+func parseListArgs(para string) (ListOptions, string) {
+	var options ListOptions
+	for strings.HasPrefix(para, "-") {
+		flags := para
+		if idx := strings.IndexByte(para, ' '); idx >= 0 {
+			flags, para = para[:idx], strings.TrimLeft(para[idx:], " ")
+		} else {
+			para = ""
+		}
+		for _, flag := range flags[1:] {
+			switch flag {
+			case 'a':
+				options.All = true
+			case 'l':
+				options.Long = true
+			case 'R':
+				options.Recursive = true
+			case 't':
+				options.SortTime = true
+			}
+		}
+	}
+	return options, para
+}
+
+// isGlob reports whether a path element is a pattern for path.Match
+func isGlob(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// hidden reports whether a file is left out of a listing: dotfiles are
+// shown with -a, or when the pattern itself starts with a dot
+func hidden(name string, pattern string, options ListOptions) bool {
+	return strings.HasPrefix(name, ".") && !options.All && !strings.HasPrefix(pattern, ".")
+}
+
+// ListFiles sends the listing of path, a directory, a file or a pattern
+// in its last element, on the data connection. Files are named with prefix
+// unless path is a directory.
+func (ftpDTP *FtpDTP) ListFiles(path string, prefix string, options ListOptions) error {
+	defer ftpDTP.closeTransfer()
+	dir, entries, err := ftpDTP.listEntries(path, prefix, options)
+	if err != nil {
+		return err
+	}
+	conn, err := ftpDTP.openConn()
+	if err != nil {
+		return err
+	}
+	ftpDTP.logger.Debug("sending file list", F("files", len(entries)))
+	w := charsetWriter{conn, ftpDTP.charset}
+	if err = ftpDTP.writeEntries(w, entries, false, options); err != nil {
+		return err
+	}
+	if options.Recursive {
+		return ftpDTP.writeTree(w, dir, entries, options)
+	}
+	return nil
+}
+
+// listEntries returns the directory holding the listed files and the
+// files, sorted as options ask
+func (ftpDTP *FtpDTP) listEntries(filePath string, prefix string, options ListOptions) (string, []listEntry, error) {
+	dir, pattern := path.Split(filePath)
+	dir = strings.TrimSuffix(dir, "/")
+	var entries []listEntry
+	if isGlob(pattern) {
+		files, err := ftpDTP.storage.ReadDir(dir)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, file := range files {
+			if matched, _ := path.Match(pattern, file.Name()); matched && !hidden(file.Name(), pattern, options) {
+				entries = append(entries, listEntry{name: prefix + file.Name(), info: file})
+			}
+		}
+	} else {
+		fileInfo, err := ftpDTP.storage.Stat(filePath)
+		if err != nil {
+			return "", nil, err
+		}
+		if !fileInfo.IsDir() {
+			return dir, []listEntry{{name: prefix + fileInfo.Name(), info: fileInfo}}, nil
+		}
+		entries, err = ftpDTP.readEntries(filePath, "", options)
+		return filePath, entries, err
+	}
+	sortEntries(entries, options)
+	return dir, entries, nil
+}
+
+// readEntries lists a directory, naming its files with prefix
+func (ftpDTP *FtpDTP) readEntries(dir string, prefix string, options ListOptions) ([]listEntry, error) {
+	files, err := ftpDTP.storage.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]listEntry, 0, len(files))
+	for _, file := range files {
+		if !hidden(file.Name(), "", options) {
+			entries = append(entries, listEntry{name: prefix + file.Name(), info: file})
+		}
+	}
+	sortEntries(entries, options)
+	return entries, nil
+}
+
+func sortEntries(entries []listEntry, options ListOptions) {
+	if options.SortTime {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].info.ModTime().After(entries[j].info.ModTime())
+		})
+	}
+}
+
+// writeEntries writes a line per file, with its bare name when bare is set
+func (ftpDTP *FtpDTP) writeEntries(w io.Writer, entries []listEntry, bare bool, options ListOptions) error {
+	for _, entry := range entries {
+		name := entry.name
+		if bare {
+			name = entry.info.Name()
+		}
+		line := name
+		if options.Long {
+			line = fileInfoLine(entry.info, name)
+		}
+		if _, err := fmt.Fprintf(w, "%s\r\n", line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTree lists the subdirectories of entries found in dir, each after
+// a "name:" header like ls -R. Directories which cannot be read are left
+// out.
+func (ftpDTP *FtpDTP) writeTree(w io.Writer, dir string, entries []listEntry, options ListOptions) error {
+	for _, entry := range entries {
+		if !entry.info.IsDir() {
+			continue
+		}
+		subDir := dir + "/" + entry.info.Name()
+		children, err := ftpDTP.readEntries(subDir, entry.name+"/", options)
+		if err != nil {
+			ftpDTP.logger.Warn("cannot list directory", F("dir", subDir), F("error", err))
+			continue
+		}
+		if _, err = fmt.Fprintf(w, "\r\n%s:\r\n", entry.name); err != nil {
+			return err
+		}
+		if err = ftpDTP.writeEntries(w, children, true, options); err != nil {
+			return err
+		}
+		if err = ftpDTP.writeTree(w, subDir, children, options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listPath resolves the argument of LIST and NLST and the prefix naming
+// the listed files, otherwise it replies 450
+func (ftpPI *FtpPI) listPath(arg string) (string, string, error) {
+	filePath := ftpPI.resolvePath(arg)
+	dir, pattern := path.Split(filePath)
+	if isGlob(pattern) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			ftpPI.writeMsgCode(501)
+			return "", "", err
+		}
+		dir = strings.TrimSuffix(dir, "/")
+		if !ftpPI.dtp.ValidPath(dir) || !ftpPI.dtp.IsDir(dir) {
+			ftpPI.writeMsgCode(450)
+			return "", "", fmt.Errorf("invalid path %v", filePath)
+		}
+	} else if !ftpPI.dtp.ValidPath(filePath) {
+		ftpPI.writeMsgCode(450)
+		return "", "", fmt.Errorf("invalid path %v", filePath)
+	} else if ftpPI.dtp.IsDir(filePath) {
+		return filePath, "", nil
+	}
+	// a pattern or a file is listed as the client named it
+	prefix := ""
+	if idx := strings.LastIndex(arg, "/"); idx >= 0 {
+		prefix = arg[:idx+1]
+	}
+	return filePath, prefix, nil
+}
+
+// handleList runs LIST, which always lists in long format, and NLST
+func (ftpPI *FtpPI) handleList(long bool) error {
+	options, arg := parseListArgs(ftpPI.para)
+	options.Long = options.Long || long
+	filePath, prefix, err := ftpPI.listPath(arg)
+	if err != nil {
+		return err
+	}
+	ftpPI.writeMsg(150, "Opening ASCII mode data connection for file list")
+	ftpPI.runTransfer(func() error {
+		return ftpPI.dtp.ListFiles(filePath, prefix, options)
+	})
+	return nil
+}
+
+// HandleNLST ...
+func (ftpPI *FtpPI) HandleNLST() error {
+	return ftpPI.handleList(false)
+}
@@ -0,0 +1,90 @@
+package ftpserver
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseListArgs(t *testing.T) {
+	tests := []struct {
+		para    string
+		options ListOptions
+		path    string
+	}{
+		{"", ListOptions{}, ""},
+		{"dir", ListOptions{}, "dir"},
+		{"-la", ListOptions{All: true, Long: true}, ""},
+		{"-a -R dir", ListOptions{All: true, Recursive: true}, "dir"},
+		{"-t  *.txt", ListOptions{SortTime: true}, "*.txt"},
+		{"-Fx my dir", ListOptions{}, "my dir"},
+	}
+	for _, test := range tests {
+		options, path := parseListArgs(test.para)
+		if options != test.options || path != test.path {
+			t.Errorf("parseListArgs(%q) = %+v, %q, want %+v, %q", test.para, options, path, test.options, test.path)
+		}
+	}
+}
+
+// list runs a listing command and returns the lines of the data connection
+func (client *testClient) list(command string) []string {
+	dataAddr := client.pasv()
+	client.cmd(command, 150)
+	data, err := net.Dial("tcp", dataAddr)
+	if err != nil {
+		client.t.Fatal(err)
+	}
+	defer data.Close()
+	content, err := ioutil.ReadAll(data)
+	if err != nil {
+		client.t.Fatal(err)
+	}
+	client.expect(226)
+	if len(content) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(content), "\r\n"), "\r\n")
+}
+
+func TestNLST(t *testing.T) {
+	_, addr, cleanup := startTestServer(t, func(config *FtpConfig) {
+		os.Mkdir(filepath.Join(config.RootDir, "sub"), 0777)
+		for _, name := range []string{".hidden", "a.log", "sub/x.txt"} {
+			ioutil.WriteFile(filepath.Join(config.RootDir, name), []byte(name), 0666)
+		}
+	})
+	defer cleanup()
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.login()
+	tests := []struct {
+		command string
+		lines   []string
+	}{
+		{"NLST", []string{"a.log", "hello.txt", "sub"}},
+		{"NLST -a", []string{".hidden", "a.log", "hello.txt", "sub"}},
+		{"NLST .h*", []string{".hidden"}},
+		{"NLST *.txt", []string{"hello.txt"}},
+		{"NLST sub/*.txt", []string{"sub/x.txt"}},
+		{"NLST /sub/x.txt", []string{"/sub/x.txt"}},
+		{"NLST *.none", nil},
+		{"NLST -R", []string{"a.log", "hello.txt", "sub", "", "sub:", "x.txt"}},
+	}
+	for _, test := range tests {
+		if lines := client.list(test.command); !reflect.DeepEqual(lines, test.lines) {
+			t.Errorf("%v = %q, want %q", test.command, lines, test.lines)
+		}
+	}
+	lines := client.list("LIST hello.txt")
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "-") || !strings.Contains(lines[0], " 6 ") || !strings.HasSuffix(lines[0], " hello.txt") {
+		t.Errorf("LIST hello.txt = %q, want a long line", lines)
+	}
+	client.cmd("NLST [", 501)
+	client.cmd("NLST missing", 450)
+	client.cmd("NLST missing/*.txt", 450)
+}
@@ -0,0 +1,240 @@
+package ftpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LogLevel ...
+type LogLevel int32
+
+const (
+	// LevelDebug ...
+	LevelDebug LogLevel = iota
+	// LevelInfo ...
+	LevelInfo
+	// LevelWarn ...
+	LevelWarn
+	// LevelError ...
+	LevelError
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+func (level LogLevel) String() string {
+	if level < LevelDebug || level > LevelError {
+		return strconv.Itoa(int(level))
+	}
+	return logLevelNames[level]
+}
+
+// ParseLogLevel ...
+func ParseLogLevel(s string) (LogLevel, error) {
+	for i, name := range logLevelNames {
+		if strings.EqualFold(s, name) {
+			return LogLevel(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q, expected one of %v", s, strings.Join(logLevelNames, ", "))
+}
+
+// Field is a key and value added to a log line
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F ...
+func F(key string, value interface{}) Field {
+	return Field{key, value}
+}
+
+// logOutput is shared by a logger and the loggers derived with With
+type logOutput struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	file   *RotatingFile
+	json   bool
+	level  int32
+}
+
+// FtpLogger The logger used for ftp server, it writes leveled lines in
+// text or JSON format, each with the fields of the logger.
+type FtpLogger struct {
+	LogFileName string
+	output      *logOutput
+	fields      []Field
+}
+
+// CreateFtpLogger opens filename for appending and rotates it with rotate,
+// "stdout" and "stderr" (or an empty name for stdout) write to the standard
+// streams. format is "text" or "json".
+func CreateFtpLogger(filename string, format string, level LogLevel, rotate RotateOptions) (*FtpLogger, error) {
+	if format != "text" && format != "json" {
+		return nil, fmt.Errorf("unknown log format %q, expected text or json", format)
+	}
+	output := &(logOutput{json: format == "json", level: int32(level)})
+	switch filename {
+	case "", "stdout":
+		output.writer = os.Stdout
+	case "stderr":
+		output.writer = os.Stderr
+	default:
+		file, err := OpenRotatingFile(filename, rotate)
+		if err != nil {
+			return nil, err
+		}
+		output.writer = file
+		output.file = file
+	}
+	return &(FtpLogger{filename, output, nil}), nil
+}
+
+// With returns a logger writing to the same output with more fields
+func (ftpLogger *FtpLogger) With(fields ...Field) *FtpLogger {
+	all := make([]Field, 0, len(ftpLogger.fields)+len(fields))
+	all = append(all, ftpLogger.fields...)
+	all = append(all, fields...)
+	return &(FtpLogger{ftpLogger.LogFileName, ftpLogger.output, all})
+}
+
+// SetLevel changes the level of the logger and of every logger derived
+// from the same output, it is safe to call while logging.
+func (ftpLogger *FtpLogger) SetLevel(level LogLevel) {
+	atomic.StoreInt32(&ftpLogger.output.level, int32(level))
+}
+
+// Level ...
+func (ftpLogger *FtpLogger) Level() LogLevel {
+	return LogLevel(atomic.LoadInt32(&ftpLogger.output.level))
+}
+
+// Debug ...
+func (ftpLogger *FtpLogger) Debug(msg string, fields ...Field) {
+	ftpLogger.write(LevelDebug, msg, fields)
+}
+
+// Info ...
+func (ftpLogger *FtpLogger) Info(msg string, fields ...Field) {
+	ftpLogger.write(LevelInfo, msg, fields)
+}
+
+// Warn ...
+func (ftpLogger *FtpLogger) Warn(msg string, fields ...Field) {
+	ftpLogger.write(LevelWarn, msg, fields)
+}
+
+// Error ...
+func (ftpLogger *FtpLogger) Error(msg string, fields ...Field) {
+	ftpLogger.write(LevelError, msg, fields)
+}
+
+// Log writes content at info level
+func (ftpLogger *FtpLogger) Log(content string) {
+	ftpLogger.write(LevelInfo, content, nil)
+}
+
+func (ftpLogger *FtpLogger) write(level LogLevel, msg string, fields []Field) {
+	if level < ftpLogger.Level() {
+		return
+	}
+	all := make([]Field, 0, len(ftpLogger.fields)+len(fields))
+	all = append(all, ftpLogger.fields...)
+	all = append(all, fields...)
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	var line []byte
+	if ftpLogger.output.json {
+		line = formatJSONLine(now, level, msg, all)
+	} else {
+		line = formatTextLine(now, level, msg, all)
+	}
+	ftpLogger.output.mutex.Lock()
+	ftpLogger.output.writer.Write(line)
+	ftpLogger.output.mutex.Unlock()
+}
+
+// formatTextLine writes "time LEVEL msg key=value ...", values with spaces
+// or quotes are quoted.
+func formatTextLine(now string, level LogLevel, msg string, fields []Field) []byte {
+	buf := make([]byte, 0, 128)
+	buf = append(buf, now...)
+	buf = append(buf, ' ')
+	buf = append(buf, strings.ToUpper(level.String())...)
+	buf = append(buf, ' ')
+	buf = append(buf, msg...)
+	for _, field := range fields {
+		value := fmt.Sprint(fieldValue(field.Value))
+		buf = append(buf, ' ')
+		buf = append(buf, field.Key...)
+		buf = append(buf, '=')
+		if value == "" || strings.ContainsAny(value, " \t\r\n\"=") {
+			buf = strconv.AppendQuote(buf, value)
+		} else {
+			buf = append(buf, value...)
+		}
+	}
+	return append(buf, '\n')
+}
+
+func formatJSONLine(now string, level LogLevel, msg string, fields []Field) []byte {
+	buf := make([]byte, 0, 128)
+	buf = append(buf, `{"time":`...)
+	buf = appendJSON(buf, now)
+	buf = append(buf, `,"level":`...)
+	buf = appendJSON(buf, level.String())
+	buf = append(buf, `,"msg":`...)
+	buf = appendJSON(buf, msg)
+	for _, field := range fields {
+		buf = append(buf, ',')
+		buf = appendJSON(buf, field.Key)
+		buf = append(buf, ':')
+		buf = appendJSON(buf, fieldValue(field.Value))
+	}
+	return append(buf, "}\n"...)
+}
+
+func appendJSON(buf []byte, v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	return append(buf, data...)
+}
+
+// fieldValue turns errors, durations and other Stringers into text so both
+// formats print them the same way
+func fieldValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case error:
+		return value.Error()
+	case fmt.Stringer:
+		return value.String()
+	}
+	return v
+}
+
+// Reopen reopens the log file after it was moved by an external tool
+func (ftpLogger *FtpLogger) Reopen() error {
+	if ftpLogger.output.file == nil {
+		return nil
+	}
+	return ftpLogger.output.file.Reopen()
+}
+
+// Close flushes and closes the log file
+func (ftpLogger *FtpLogger) Close() error {
+	if ftpLogger.output.file == nil {
+		return nil
+	}
+	ftpLogger.output.mutex.Lock()
+	defer ftpLogger.output.mutex.Unlock()
+	ftpLogger.output.file.Sync()
+	return ftpLogger.output.file.Close()
+}
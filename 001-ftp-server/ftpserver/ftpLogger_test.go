@@ -0,0 +1,81 @@
+package ftpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readLog closes the logger and returns the lines written to name
+func readLog(t *testing.T, logger *FtpLogger, name string) []string {
+	logger.Close()
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func TestLoggerText(t *testing.T) {
+	name := writeTempFile(t, "")
+	defer os.Remove(name)
+	logger, err := CreateFtpLogger(name, "text", LevelInfo, RotateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := logger.With(F("session", 7))
+	session.Debug("hidden")
+	session.Info("login", F("user", "ABC"), F("error", fmt.Errorf("bad \"pass\"")), F("took", 2*time.Second))
+	logger.SetLevel(LevelError)
+	session.Warn("hidden by SetLevel on the parent")
+	session.Error("failed", F("path", ""))
+	lines := readLog(t, logger, name)
+	if len(lines) != 2 {
+		t.Fatalf("got %q, want the info and error lines", lines)
+	}
+	want := []string{` INFO login session=7 user=ABC error="bad \"pass\"" took=2s`, ` ERROR failed session=7 path=""`}
+	for i, line := range lines {
+		if _, err := time.Parse(time.RFC3339Nano, strings.Fields(line)[0]); err != nil {
+			t.Errorf("line %q does not start with a time: %v", line, err)
+		}
+		if !strings.HasSuffix(line, want[i]) {
+			t.Errorf("got %q, want it to end with %q", line, want[i])
+		}
+	}
+}
+
+func TestLoggerJSON(t *testing.T) {
+	name := writeTempFile(t, "")
+	defer os.Remove(name)
+	logger, err := CreateFtpLogger(name, "json", LevelDebug, RotateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.With(F("session", 7)).Debug("transfer", F("bytes", 42), F("error", fmt.Errorf("reset")))
+	lines := readLog(t, logger, name)
+	var entry map[string]interface{}
+	if len(lines) != 1 || json.Unmarshal([]byte(lines[0]), &entry) != nil {
+		t.Fatalf("got %q, want one JSON line", lines)
+	}
+	if entry["level"] != "debug" || entry["msg"] != "transfer" || entry["session"] != 7.0 || entry["bytes"] != 42.0 || entry["error"] != "reset" {
+		t.Errorf("got %v", entry)
+	}
+}
+
+func TestLoggerOptions(t *testing.T) {
+	if _, err := CreateFtpLogger("stdout", "xml", LevelInfo, RotateOptions{}); err == nil {
+		t.Errorf("format xml accepted")
+	}
+	for _, name := range []string{"debug", "INFO", "warn", "error"} {
+		if level, err := ParseLogLevel(name); err != nil || level.String() != strings.ToLower(name) {
+			t.Errorf("ParseLogLevel(%q) = %v, %v", name, level, err)
+		}
+	}
+	if _, err := ParseLogLevel("verbose"); err == nil {
+		t.Errorf("level verbose accepted")
+	}
+}
@@ -0,0 +1,217 @@
+package ftpserver
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// transferBuckets are the upper bounds in seconds of the transfer duration
+// histogram
+var transferBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 900}
+
+// metric is written in the Prometheus text exposition format
+type metric interface {
+	write(buf *bytes.Buffer)
+}
+
+// CounterVec is a counter per combination of label values
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+	mutex  sync.Mutex
+	values map[string]*uint64
+}
+
+// Inc adds one to the counter of the label values, given in label order
+func (counter *CounterVec) Inc(values ...string) {
+	counter.Add(1, values...)
+}
+
+// Add ...
+func (counter *CounterVec) Add(n uint64, values ...string) {
+	key := labelPairs(counter.labels, values)
+	counter.mutex.Lock()
+	value, ok := counter.values[key]
+	if !ok {
+		value = new(uint64)
+		counter.values[key] = value
+	}
+	counter.mutex.Unlock()
+	atomic.AddUint64(value, n)
+}
+
+func (counter *CounterVec) write(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "# HELP %v %v\n# TYPE %v counter\n", counter.name, counter.help, counter.name)
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	for _, key := range sortedKeys(counter.values) {
+		fmt.Fprintf(buf, "%v%v %v\n", counter.name, key, atomic.LoadUint64(counter.values[key]))
+	}
+}
+
+// Gauge ...
+type Gauge struct {
+	name  string
+	help  string
+	value int64
+}
+
+// Add adds n, which may be negative
+func (gauge *Gauge) Add(n int64) {
+	atomic.AddInt64(&gauge.value, n)
+}
+
+// Value ...
+func (gauge *Gauge) Value() int64 {
+	return atomic.LoadInt64(&gauge.value)
+}
+
+func (gauge *Gauge) write(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "# HELP %v %v\n# TYPE %v gauge\n%v %v\n", gauge.name, gauge.help, gauge.name, gauge.name, gauge.Value())
+}
+
+// HistogramVec is a histogram per combination of label values
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	mutex   sync.Mutex
+	values  map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Observe records v for the label values, given in label order
+func (vec *HistogramVec) Observe(v float64, values ...string) {
+	key := labelPairs(vec.labels, values)
+	vec.mutex.Lock()
+	defer vec.mutex.Unlock()
+	h, ok := vec.values[key]
+	if !ok {
+		h = &(histogram{counts: make([]uint64, len(vec.buckets))})
+		vec.values[key] = h
+	}
+	for i, bound := range vec.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (vec *HistogramVec) write(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "# HELP %v %v\n# TYPE %v histogram\n", vec.name, vec.help, vec.name)
+	vec.mutex.Lock()
+	defer vec.mutex.Unlock()
+	for _, key := range sortedKeys(vec.values) {
+		h := vec.values[key]
+		// the le label goes after the others
+		prefix := "{"
+		if key != "" {
+			prefix = key[:len(key)-1] + ","
+		}
+		for i, bound := range vec.buckets {
+			fmt.Fprintf(buf, "%v_bucket%vle=\"%v\"} %v\n", vec.name, prefix, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(buf, "%v_bucket%vle=\"+Inf\"} %v\n", vec.name, prefix, h.count)
+		fmt.Fprintf(buf, "%v_sum%v %v\n", vec.name, key, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(buf, "%v_count%v %v\n", vec.name, key, h.count)
+	}
+}
+
+var labelEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+// labelPairs formats label values as {a="1",b="2"}, the empty string for
+// no labels
+func labelPairs(labels []string, values []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(labels))
+	for i, label := range labels {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = label + "=\"" + labelEscaper.Replace(value) + "\""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch values := m.(type) {
+	case map[string]*uint64:
+		for key := range values {
+			keys = append(keys, key)
+		}
+	case map[string]*histogram:
+		for key := range values {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// FtpMetrics holds the metrics of a FTP server
+type FtpMetrics struct {
+	ConnectionsAccepted *CounterVec
+	ConnectionsRejected *CounterVec
+	SessionsActive      *Gauge
+	Logins              *CounterVec
+	Commands            *CounterVec
+	TransferBytes       *CounterVec
+	TransferDuration    *HistogramVec
+	PassivePortsInUse   *Gauge
+	HookDeliveries      *CounterVec
+	all                 []metric
+}
+
+// CreateFtpMetrics ...
+func CreateFtpMetrics() *FtpMetrics {
+	counter := func(name, help string, labels ...string) *CounterVec {
+		return &(CounterVec{name: name, help: help, labels: labels, values: make(map[string]*uint64)})
+	}
+	metrics := &(FtpMetrics{
+		ConnectionsAccepted: counter("myftp_connections_accepted_total", "Control connections accepted."),
+		ConnectionsRejected: counter("myftp_connections_rejected_total", "Control connections rejected, by reason.", "reason"),
+		SessionsActive:      &(Gauge{name: "myftp_sessions_active", help: "Sessions currently open."}),
+		Logins:              counter("myftp_logins_total", "Login attempts, by result.", "result"),
+		Commands:            counter("myftp_commands_total", "Commands handled, by verb and reply code.", "command", "code"),
+		TransferBytes:       counter("myftp_transfer_bytes_total", "Bytes transferred by RETR (sent) and STOR (received).", "direction"),
+		TransferDuration: &(HistogramVec{name: "myftp_transfer_duration_seconds", help: "Duration of RETR and STOR transfers.",
+			labels: []string{"direction"}, buckets: transferBuckets, values: make(map[string]*histogram)}),
+		PassivePortsInUse: &(Gauge{name: "myftp_passive_ports_in_use", help: "Passive ports currently listening."}),
+		HookDeliveries:    counter("myftp_hook_deliveries_total", "Events delivered to hooks, by hook kind and result.", "hook", "result"),
+	})
+	// the counters without labels are written as 0 before their first use
+	metrics.ConnectionsAccepted.Add(0)
+	metrics.all = []metric{metrics.ConnectionsAccepted, metrics.ConnectionsRejected, metrics.SessionsActive,
+		metrics.Logins, metrics.Commands, metrics.TransferBytes, metrics.TransferDuration, metrics.PassivePortsInUse,
+		metrics.HookDeliveries}
+	return metrics
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format
+func (metrics *FtpMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	for _, m := range metrics.all {
+		m.write(&buf)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,76 @@
+package ftpserver
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scrape returns the metrics in the text format
+func scrape(metrics *FtpMetrics) string {
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	return recorder.Body.String()
+}
+
+// checkMetrics fails for every line of want missing from the scraped text
+func checkMetrics(t *testing.T, text string, want []string) {
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(text, "\n") {
+		lines[line] = true
+	}
+	for _, line := range want {
+		if !lines[line] {
+			t.Errorf("missing %q in\n%v", line, text)
+		}
+	}
+}
+
+func TestMetricsFormat(t *testing.T) {
+	metrics := CreateFtpMetrics()
+	metrics.Commands.Inc("RETR", "226")
+	metrics.Commands.Add(2, "RETR", "226")
+	metrics.ConnectionsRejected.Inc("a \"quoted\"\nreason")
+	metrics.SessionsActive.Add(2)
+	metrics.SessionsActive.Add(-1)
+	metrics.TransferDuration.Observe(0.2, "sent")
+	metrics.TransferDuration.Observe(20, "sent")
+	checkMetrics(t, scrape(metrics), []string{
+		"# TYPE myftp_connections_accepted_total counter",
+		"myftp_connections_accepted_total 0",
+		`myftp_commands_total{command="RETR",code="226"} 3`,
+		`myftp_connections_rejected_total{reason="a \"quoted\"\nreason"} 1`,
+		"# TYPE myftp_sessions_active gauge",
+		"myftp_sessions_active 1",
+		"# TYPE myftp_transfer_duration_seconds histogram",
+		`myftp_transfer_duration_seconds_bucket{direction="sent",le="0.1"} 0`,
+		`myftp_transfer_duration_seconds_bucket{direction="sent",le="0.5"} 1`,
+		`myftp_transfer_duration_seconds_bucket{direction="sent",le="30"} 2`,
+		`myftp_transfer_duration_seconds_bucket{direction="sent",le="+Inf"} 2`,
+		`myftp_transfer_duration_seconds_sum{direction="sent"} 20.2`,
+		`myftp_transfer_duration_seconds_count{direction="sent"} 2`,
+	})
+}
+
+func TestMetricsSession(t *testing.T) {
+	ftpServer, addr, cleanup := startTestServer(t, nil)
+	defer cleanup()
+	client := dialTestClient(t, addr)
+	client.cmd("USER ABC", 331)
+	client.cmd("PASS wrong", 530)
+	client.login()
+	client.retr("hello.txt")
+	checkMetrics(t, scrape(ftpServer.metrics), []string{
+		"myftp_connections_accepted_total 1",
+		"myftp_sessions_active 1",
+		`myftp_logins_total{result="failure"} 1`,
+		`myftp_logins_total{result="success"} 1`,
+		`myftp_commands_total{command="PASV",code="227"} 1`,
+		`myftp_transfer_bytes_total{direction="sent"} 6`,
+		`myftp_transfer_duration_seconds_count{direction="sent"} 1`,
+		"myftp_passive_ports_in_use 0",
+	})
+	client.cmd("QUIT", 221)
+	client.expectClosed()
+	client.conn.Close()
+}
@@ -0,0 +1,59 @@
+package ftpserver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// makeDir creates the directory path with the mode 777 less the umask of
+// the account, the storage keeps its own mode when none is set
+func (ftpDTP *FtpDTP) makeDir(dirMaker DirMaker, path string) error {
+	if ftpDTP.umask < 0 {
+		return dirMaker.Mkdir(path, 0777)
+	}
+	mode := 0777 &^ os.FileMode(ftpDTP.umask)
+	if err := dirMaker.Mkdir(path, mode); err != nil {
+		return err
+	}
+	// the umask of the process applies to Mkdir as well, the account's
+	// is the one clients expect
+	if chmoder, ok := ftpDTP.storage.(Chmoder); ok {
+		return chmoder.Chmod(path, mode)
+	}
+	return nil
+}
+
+// HandleMKD creates a directory in an existing directory of the root and
+// replies 257 with its path, quotes doubled as in RFC 959
+func (ftpPI *FtpPI) HandleMKD() error {
+	dirMaker, ok := ftpPI.dtp.storage.(DirMaker)
+	if !ok {
+		ftpPI.writeMsgCode(502)
+		return fmt.Errorf("storage cannot create directories")
+	}
+	path := ftpPI.resolvePath(strings.TrimRight(ftpPI.para, "/"))
+	idx := strings.LastIndex(path, "/")
+	if idx <= 0 || !ftpPI.dtp.ValidPath(path[:idx]) || !ftpPI.dtp.IsDir(path[:idx]) {
+		ftpPI.writeMsg(550, "Directory not found.")
+		return fmt.Errorf("invalid path %v", path)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil || !strings.HasPrefix(absPath, ftpPI.dtp.userRootPath+string(filepath.Separator)) {
+		ftpPI.writeMsg(550, "Permission denied.")
+		return fmt.Errorf("path %v is outside the root", path)
+	}
+	if err = ftpPI.dtp.makeDir(dirMaker, absPath); err != nil {
+		if os.IsExist(err) {
+			ftpPI.writeMsg(550, "File exists.")
+		} else {
+			ftpPI.writeMsg(550, "Cannot create the directory.")
+		}
+		return err
+	}
+	ftpPI.logger.Info("directory created", F("path", absPath))
+	name := filepath.ToSlash(ftpPI.dtp.clientPath(absPath))
+	ftpPI.writeMsg(257, "\""+strings.Replace(name, "\"", "\"\"", -1)+"\" created.")
+	return nil
+}
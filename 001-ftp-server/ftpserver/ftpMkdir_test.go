@@ -0,0 +1,50 @@
+package ftpserver
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestMKD(t *testing.T) {
+	var rootDir string
+	_, addr, cleanup := startTestServer(t, func(config *FtpConfig) {
+		rootDir = config.RootDir
+	})
+	defer cleanup()
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.cmd("MKD new", 530)
+	client.login()
+	tests := []struct {
+		command string
+		reply   string
+		dir     string
+	}{
+		{"MKD new", `257 "/new" created.`, "new"},
+		{"XMKD /new/sub/", `257 "/new/sub" created.`, "new/sub"},
+		{`MKD say "hi"`, `257 "/say ""hi""" created.`, `say "hi"`},
+		{"MKD new", "550 File exists.", "new"},
+		{"MKD hello.txt", "550 File exists.", ""},
+		{"MKD missing/sub", "550 Directory not found.", ""},
+		{"MKD hello.txt/sub", "550 Directory not found.", ""},
+		{"MKD ..", "550 Permission denied.", ""},
+		{"MKD /new/../../escaped", "550 Directory not found.", ""},
+		{"MKD", "501", ""},
+	}
+	for _, test := range tests {
+		code, _ := strconv.Atoi(test.reply[:3])
+		if reply := client.cmd(test.command, code); len(test.reply) > 3 && reply != test.reply {
+			t.Errorf("%v = %q, want %q", test.command, reply, test.reply)
+		}
+		if test.dir != "" {
+			if fileInfo, err := os.Stat(filepath.Join(rootDir, test.dir)); err != nil || !fileInfo.IsDir() {
+				t.Errorf("%v did not create %v", test.command, test.dir)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(rootDir), "escaped")); err == nil {
+		t.Errorf("MKD created a directory outside the root")
+	}
+}
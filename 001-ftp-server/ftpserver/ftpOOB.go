@@ -0,0 +1,26 @@
+//go:build go1.9 && !windows
+// +build go1.9,!windows
+
+package ftpserver
+
+import (
+	"net"
+	"syscall"
+)
+
+// setOOBInline keeps TCP urgent data in the stream of the control
+// connection, clients send the Telnet Synch of ABOR or the end of the ABOR
+// line itself as urgent data and it would be lost otherwise
+func setOOBInline(conn net.Conn) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+	rawConn, err := tcpConn.SyscallConn()
+	if err != nil {
+		return
+	}
+	rawConn.Control(func(fd uintptr) {
+		syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_OOBINLINE, 1)
+	})
+}
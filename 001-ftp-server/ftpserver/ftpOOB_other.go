@@ -0,0 +1,11 @@
+//go:build !go1.9 || windows
+// +build !go1.9 windows
+
+package ftpserver
+
+import "net"
+
+// setOOBInline needs SyscallConn from Go 1.9, without it urgent data sent
+// with ABOR may be lost
+func setOOBInline(conn net.Conn) {
+}
@@ -0,0 +1,685 @@
+package ftpserver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplyMap ...
+var ReplyMap = map[int]string{
+	200: "Command okay.",
+	500: "Syntax error, command unrecognized.\r\nThis may include errors such as command line too long.",
+	501: "Syntax error in parameters or arguments.",
+	202: "Command not implemented, superfluous at this site.",
+	502: "Command not implemented.",
+	503: "Bad sequence of commands.",
+	504: "Command not implemented for that parameter.",
+	110: "Restart marker reply.\r\nIn this case, the text is exact and not left to the particular implementation; it must read: \r\nMARK yyyy = mmmm\r\nWhere yyyy is User-process data stream marker, and mmmm	server's equivalent marker (note the spaces between markers and \"=\").",
+	211: "System status, or system help reply.",
+	212: "Directory status.",
+	213: "File status.",
+	214: "Help message.\r\nOn how to use the server or the meaning of a particular non-standard command.  This reply is useful only to the human user.",
+	215: "NAME system type.\r\nWhere NAME is an official system name from the list in the Assigned Numbers document.",
+	120: "Service ready in nnn minutes.",
+	220: "Service ready for new user.",
+	221: "Service closing control connection.\r\nLogged out if appropriate.",
+	421: "Service not available, closing control connection.\r\nThis may be a reply to any command if the service knows it must shut down.",
+	125: "Data connection already open; transfer starting.",
+	225: "Data connection open; no transfer in progress.",
+	425: "Can't open data connection.",
+	226: "Closing data connection.\r\nRequested file action successful (for example, file transfer or file abort).",
+	426: "Connection closed; transfer aborted.",
+	227: "Entering Passive Mode (h1,h2,h3,h4,p1,p2).",
+	230: "User logged in, proceed.",
+	530: "Not logged in.",
+	331: "User name okay, need password.",
+	332: "Need account for login.",
+	532: "Need account for storing files.",
+	150: "File status okay; about to open data connection.",
+	250: "Requested file action okay, completed.",
+	257: "\"PATHNAME\" created.",
+	350: "Requested file action pending further information.",
+	450: "Requested file action not taken.\r\nFile unavailable (e.g., file busy).",
+	550: "Requested action not taken.\r\nFile unavailable (e.g., file not found, no access).",
+	451: "Requested action aborted. Local error in processing.",
+	551: "Requested action aborted. Page type unknown.",
+	452: "Requested action not taken.\r\nInsufficient storage space in system.",
+	552: "Requested file action aborted.\r\nExceeded storage allocation (for current directory or dataset).",
+	553: "Requested action not taken.\r\nFile name not allowed.",
+}
+
+// noticeWriteTimeout bounds the write of the 421 sent before the server
+// closes a session, a client which stopped reading cannot block the caller
+const noticeWriteTimeout = 2 * time.Second
+
+const (
+	// TypeBinary ...
+	TypeBinary = 0
+	// TypeASCII ...
+	TypeASCII = 1
+)
+
+// FtpPI ...
+type FtpPI struct {
+	id      uint64
+	server  *FtpServer
+	conn    net.Conn
+	user    string
+	pass    string
+	auth    bool
+	comm    string
+	para    string
+	curPath string
+	dtp     *FtpDTP
+	// logger adds the user and command to the fields of sessionLogger, it
+	// is updated by setLogContext before each command
+	sessionLogger *FtpLogger
+	logger        *FtpLogger
+	writer        *bufio.Writer
+	reader        *bufio.Reader
+	typeT         int
+	settings      *FtpServerSettings
+	start         time.Time
+	bans          *FtpBanList
+	failures      int
+	metrics       *FtpMetrics
+	// allowChmod is set by the chmod=yes option of the account, homePath is
+	// the directory of the account, SITE CHMOD only changes what is below
+	allowChmod bool
+	homePath   string
+	// allowWho is set by the site_who=yes option of the account, SITE WHO
+	// shows the users and addresses of every session
+	allowWho bool
+	// charsetName is the encoding of the session, set from the account
+	// charset option by login, by OPTS UTF8 and by SITE CHARSET
+	charsetName    string
+	accountCharset string
+	// idleTimeout starts as the one of the server, SITE IDLE lowers it, it
+	// is guarded by stateMutex
+	idleTimeout time.Duration
+	// lastCode is the code of the last reply, counted per command in metrics
+	lastCode int
+	// busy is set while a command runs, draining once the server shuts down,
+	// transferDone is closed when the background transfer ends and aborted
+	// is set by ABOR
+	stateMutex   sync.Mutex
+	busy         bool
+	draining     bool
+	transferDone chan struct{}
+	aborted      bool
+	// asyncCommand is set when the command started a background transfer,
+	// which counts it in metrics once done
+	asyncCommand bool
+	// info is the state listed by the admin API, updated around commands
+	// under stateMutex
+	info SessionInfo
+	// writeMutex serializes replies written by the session and by Drain,
+	// and guards the broadcast messages waiting for the next reply
+	writeMutex sync.Mutex
+	pending    []string
+	// hashAlgorithm is selected by OPTS HASH, rangeStart and rangeEnd are
+	// set by RANG for the next HASH, rangeEnd -1 meaning the end of file
+	hashAlgorithm string
+	rangeStart    int64
+	rangeEnd      int64
+}
+
+// errLoginBlocked is returned by HandlePASS when the session is closed
+var errLoginBlocked = fmt.Errorf("too many failed logins")
+
+// CreateFtpPI ...
+func CreateFtpPI(conn net.Conn, server *FtpServer) (*FtpPI, error) {
+	id := server.nextSessionID()
+	logger := server.logger.With(F("session", id), F("ip", remoteIP(conn)))
+	dtp, err := CreateFtpDTP(server.settings, id, net.ParseIP(remoteIP(conn)), logger, server.xferLog, server.hooks,
+		server.metrics)
+	if err != nil {
+		logger.Error("cannot create DTP", F("error", err))
+		return nil, err
+	}
+	pi := &(FtpPI{id: id, server: server, conn: conn, curPath: server.settings.rootDir, dtp: dtp, sessionLogger: logger,
+		logger: logger, settings: server.settings, start: time.Now(), bans: server.bans, metrics: server.metrics,
+		hashAlgorithm: defaultHashAlgorithm, rangeEnd: -1, idleTimeout: server.settings.idleTimeout,
+		charsetName: defaultCharset, accountCharset: defaultCharset})
+	pi.writer = bufio.NewWriter(conn)
+	pi.reader = bufio.NewReader(conn)
+	pi.info = SessionInfo{ID: id, RemoteAddr: conn.RemoteAddr().String(), Started: pi.start, lastActive: pi.start}
+	return pi, nil
+}
+
+// Serve ...
+func (ftpPI *FtpPI) Serve() {
+	// the logout event comes after the event of a running transfer
+	defer ftpPI.logout()
+	// a passive port prepared but never used is released with the session,
+	// and a transfer still running is aborted
+	defer ftpPI.dtp.closeTransfer()
+	defer ftpPI.waitTransfer(true)
+	// reader := bufio.NewReader(os.Stdin)
+	msg, err := ftpPI.welcome()
+	if err == nil {
+		ftpPI.writeMsg(220, msg)
+		ftpPI.logger.Info("session started", F("remote", ftpPI.conn.RemoteAddr()))
+	} else {
+		ftpPI.writeMsgCode(500)
+		ftpPI.logger.Error("cannot build welcome message", F("error", err))
+		return
+	}
+	for {
+		ftpPI.resetReadDeadline()
+		ins, err := ftpPI.reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				ftpPI.conn.Close()
+				ftpPI.logger.Info("session closed by client")
+				return
+			}
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				if ftpPI.auth {
+					ftpPI.writeMsg(421, "Idle timeout, closing control connection.")
+				} else {
+					ftpPI.writeMsg(421, "Login timeout, closing control connection.")
+				}
+				ftpPI.conn.Close()
+				ftpPI.logger.Info("session timed out", F("logged_in", ftpPI.auth))
+				return
+			}
+			ftpPI.conn.Close()
+			ftpPI.logger.Debug("session closed", F("error", err))
+			return
+		}
+		// inses := strings.Fields(ins)
+		inses := strings.SplitN(strings.Trim(stripTelnet(ins), "\r\n"), " ", 2)
+		ftpPI.comm = ""
+		ftpPI.para = ""
+		if len(inses) == 1 {
+			ftpPI.comm = inses[0]
+			ftpPI.para = ""
+		} else {
+			ftpPI.comm = inses[0]
+			ftpPI.para = inses[1]
+		}
+		if ftpPI.comm != "" {
+			if !ftpPI.beginCommand() {
+				return
+			}
+			ftpPI.setLogContext()
+			if ftpPI.comm == "PASS" {
+				ftpPI.logger.Debug("command received")
+			} else {
+				ftpPI.logger.Debug("command received", F("arg", ftpPI.para))
+			}
+			ftpPI.asyncCommand = false
+			quit, err := ftpPI.HandleCommand()
+			if !ftpPI.asyncCommand {
+				ftpPI.countCommand()
+			}
+			if err != nil && err != errLoginBlocked {
+				ftpPI.logger.Debug("command failed", F("error", err))
+			}
+			if ftpPI.endCommand() || quit {
+				return
+			}
+		}
+	}
+}
+
+// countCommand counts the command with the code of its last reply,
+// unknown verbs are counted as OTHER
+func (ftpPI *FtpPI) countCommand() {
+	ftpPI.writeMutex.Lock()
+	code := ftpPI.lastCode
+	ftpPI.writeMutex.Unlock()
+	command := ftpPI.comm
+	if code == 502 {
+		command = "OTHER"
+	}
+	ftpPI.metrics.Commands.Inc(command, strconv.Itoa(code))
+}
+
+// setLogContext adds the current user and command to the session logger
+// and to the logger of its data transfers, which keeps the context of a
+// running transfer
+func (ftpPI *FtpPI) setLogContext() {
+	fields := []Field{F("command", ftpPI.comm)}
+	if ftpPI.user != "" {
+		fields = append(fields, F("user", ftpPI.user))
+	}
+	ftpPI.logger = ftpPI.sessionLogger.With(fields...)
+	if !ftpPI.transferring() {
+		ftpPI.dtp.logger = ftpPI.logger
+	}
+}
+
+// beginCommand marks the session busy, it fails when the session was
+// drained, after waiting for a running transfer which then closes it
+func (ftpPI *FtpPI) beginCommand() bool {
+	ftpPI.stateMutex.Lock()
+	defer ftpPI.stateMutex.Unlock()
+	if ftpPI.draining {
+		done := ftpPI.transferDone
+		if done != nil {
+			ftpPI.stateMutex.Unlock()
+			<-done
+			ftpPI.stateMutex.Lock()
+		}
+		return false
+	}
+	ftpPI.busy = true
+	ftpPI.info.Command = ftpPI.comm
+	if ftpPI.comm != "PASS" && ftpPI.para != "" {
+		ftpPI.info.Command += " " + ftpPI.para
+	}
+	ftpPI.info.lastActive = time.Now()
+	return true
+}
+
+// endCommand marks the session idle and closes it when the server is
+// draining and no transfer runs, it reports whether the session was closed.
+func (ftpPI *FtpPI) endCommand() bool {
+	ftpPI.stateMutex.Lock()
+	ftpPI.busy = false
+	draining := ftpPI.draining && ftpPI.transferDone == nil
+	ftpPI.info.Command = ""
+	ftpPI.info.lastActive = time.Now()
+	if ftpPI.auth {
+		ftpPI.info.User = ftpPI.user
+		ftpPI.info.Dir = ftpPI.dtp.clientPath(ftpPI.curPath)
+	}
+	ftpPI.stateMutex.Unlock()
+	if draining {
+		ftpPI.closeDrained()
+	}
+	return draining
+}
+
+// Drain closes the session with a 421 if it is idle, a running command or
+// transfer is left to finish and the session closes right after it.
+func (ftpPI *FtpPI) Drain() {
+	ftpPI.stateMutex.Lock()
+	ftpPI.draining = true
+	idle := !ftpPI.busy && ftpPI.transferDone == nil
+	ftpPI.stateMutex.Unlock()
+	if idle {
+		ftpPI.closeDrained()
+	}
+}
+
+// closeDrained writes the 421 of a drained session and closes it, the
+// write gives up after noticeWriteTimeout
+func (ftpPI *FtpPI) closeDrained() {
+	ftpPI.conn.SetWriteDeadline(time.Now().Add(noticeWriteTimeout))
+	ftpPI.writeMsg(421, "Service shutting down.")
+	ftpPI.conn.Close()
+}
+
+// Close closes the control connection and any data connection at once
+func (ftpPI *FtpPI) Close() {
+	ftpPI.conn.Close()
+	ftpPI.dtp.abort()
+}
+
+// resetReadDeadline restarts the idle and login timeouts, they are off
+// while a transfer runs and restarted when it ends
+func (ftpPI *FtpPI) resetReadDeadline() {
+	ftpPI.stateMutex.Lock()
+	defer ftpPI.stateMutex.Unlock()
+	if ftpPI.transferDone != nil {
+		ftpPI.conn.SetReadDeadline(time.Time{})
+		return
+	}
+	ftpPI.conn.SetReadDeadline(ftpPI.readDeadline())
+}
+
+// readDeadline returns when the next command must have arrived, the zero
+// time means no deadline.
+func (ftpPI *FtpPI) readDeadline() time.Time {
+	var deadline time.Time
+	if ftpPI.idleTimeout > 0 {
+		deadline = time.Now().Add(ftpPI.idleTimeout)
+	}
+	if !ftpPI.auth && ftpPI.settings.loginTimeout > 0 {
+		loginDeadline := ftpPI.start.Add(ftpPI.settings.loginTimeout)
+		if deadline.IsZero() || loginDeadline.Before(deadline) {
+			deadline = loginDeadline
+		}
+	}
+	return deadline
+}
+
+func (ftpPI *FtpPI) writeLine(content string) {
+	ftpPI.writeMutex.Lock()
+	defer ftpPI.writeMutex.Unlock()
+	if len(content) >= 3 {
+		if code, err := strconv.Atoi(content[:3]); err == nil {
+			ftpPI.lastCode = code
+			// broadcast messages become the first lines of a multi-line reply
+			for _, msg := range ftpPI.pending {
+				ftpPI.writer.Write([]byte(encodeLine(ftpPI.dtp.charset, fmt.Sprintf("%v-%v\r\n", code, msg))))
+			}
+			ftpPI.pending = nil
+		}
+	}
+	ftpPI.writer.Write([]byte(encodeLine(ftpPI.dtp.charset, content)))
+	ftpPI.writer.Write([]byte("\r\n"))
+	ftpPI.writer.Flush()
+}
+
+func (ftpPI *FtpPI) writeMsg(code int, content string) {
+	ftpPI.writeLine(fmt.Sprintf("%v %v", code, content))
+}
+
+func (ftpPI *FtpPI) writeMsgCode(code int) {
+	ftpPI.writeLine(fmt.Sprintf("%v %v", code, ReplyMap[code]))
+}
+
+// writeTransferError replies to a failed LIST, RETR or STOR and returns
+// the reply code
+func (ftpPI *FtpPI) writeTransferError(err error) int {
+	if _, ok := err.(*DataConnError); ok {
+		ftpPI.writeMsgCode(425)
+		ftpPI.dtp.logger.Warn("cannot open data connection", F("error", err))
+		return 425
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		ftpPI.writeMsg(426, "Data connection stalled; transfer aborted.")
+		ftpPI.dtp.logger.Warn("transfer stalled", F("error", err))
+		return 426
+	}
+	ftpPI.writeMsgCode(451)
+	ftpPI.dtp.logger.Error("transfer failed", F("error", err))
+	return 451
+}
+
+func (ftpPI *FtpPI) welcome() (string, error) {
+	return fmt.Sprintf("Welcome to MyFTP, your user name is %v, your id is %v, your current working directory is %v, your ip address is %v", ftpPI.user, 1, ftpPI.curPath, ftpPI.conn.RemoteAddr()), nil
+}
+
+// HandleUSER ...
+func (ftpPI *FtpPI) HandleUSER() error {
+	ftpPI.user = ftpPI.para
+	if ftpPI.user == "" {
+		ftpPI.writeMsgCode(332)
+		return fmt.Errorf("invalid user name")
+	}
+	ftpPI.logout()
+	ftpPI.writeMsgCode(331)
+	return nil
+}
+
+// HandlePASS ...
+func (ftpPI *FtpPI) HandlePASS() error {
+	ftpPI.pass = ftpPI.para
+	ip := remoteIP(ftpPI.conn)
+	if banned, _ := ftpPI.bans.IsBanned(ip); banned {
+		return ftpPI.blockLogin("421 Too many failed logins, try again later.")
+	}
+	account, err := ftpPI.settings.authenticator.Authenticate(ftpPI.user, ftpPI.pass)
+	if err != nil && err != ErrAuthFailed {
+		ftpPI.logger.Error("cannot check credentials", F("error", err))
+		ftpPI.writeMsg(451, "Cannot check credentials, try again later.")
+		return err
+	}
+	if err != nil {
+		ftpPI.failures++
+		ftpPI.metrics.Logins.Inc("failure")
+		ftpPI.logger.Warn("login failed", F("attempt", ftpPI.failures))
+		if ftpPI.bans.RecordFailure(ip) {
+			ftpPI.logger.Warn("address banned", F("duration", ftpPI.settings.banDuration))
+			return ftpPI.blockLogin("421 Too many failed logins, try again later.")
+		}
+		time.Sleep(time.Duration(ftpPI.failures) * ftpPI.settings.loginFailDelay)
+		if ftpPI.settings.maxLoginAttempts > 0 && ftpPI.failures >= ftpPI.settings.maxLoginAttempts {
+			ftpPI.logger.Warn("too many failed logins, closing session", F("attempts", ftpPI.failures))
+			return ftpPI.blockLogin("421 Too many failed login attempts, closing control connection.")
+		}
+		ftpPI.writeMsgCode(530)
+		return err
+	}
+	if allowed, rule := account.Access.Check(ip); !allowed {
+		ftpPI.logger.Warn("account access denied", F("rule", rule))
+		ftpPI.writeMsg(530, "Login not allowed from your address.")
+		return fmt.Errorf("user %v cannot login from %v", ftpPI.user, ip)
+	}
+	// ftpPI.curPath = RootDir + dir
+	ftpPI.curPath = ftpPI.settings.rootDir
+	ftpPI.dtp.userRootPath = ftpPI.curPath
+	ftpPI.dtp.allowFXP = account.Options["fxp"] == "yes"
+	ftpPI.allowWho = account.Options["site_who"] == "yes"
+	ftpPI.setAccountMode(account)
+	ftpPI.setAccountCharset(account)
+	ftpPI.dtp.user = ftpPI.user
+	ftpPI.auth = true
+	ftpPI.metrics.Logins.Inc("success")
+	ftpPI.logger.Info("user logged in", F("dir", ftpPI.curPath))
+	ftpPI.dtp.fireEvent(Event{Type: EventLogin})
+	ftpPI.writeMsgCode(230)
+	return nil
+}
+
+// logout fires the logout event when a user is logged in, once the session
+// ends or USER starts another login
+func (ftpPI *FtpPI) logout() {
+	if ftpPI.auth {
+		ftpPI.auth = false
+		ftpPI.dtp.fireEvent(Event{Type: EventLogout})
+	}
+}
+
+// blockLogin replies with the 421 line and closes the session
+func (ftpPI *FtpPI) blockLogin(reply string) error {
+	ftpPI.writeLine(reply)
+	ftpPI.conn.Close()
+	return errLoginBlocked
+}
+
+// HandleSYST ...
+func (ftpPI *FtpPI) HandleSYST() error {
+	ftpPI.writeMsg(215, "Type: Unix")
+	return nil
+}
+
+// HandleFEAT ...
+func (ftpPI *FtpPI) HandleFEAT() error {
+	ftpPI.writeLine(multiLine(211, "Features:", ftpPI.features(), "End"))
+	return nil
+}
+
+// features are the FEAT lines, without the leading space
+func (ftpPI *FtpPI) features() []string {
+	features := ftpPI.timeFeatures()
+	return append(features, ftpPI.hashFeature(), "UTF8", "XCRC", "XMD5", "XSHA1", "XSHA256")
+}
+
+// HandleOPTS ...
+func (ftpPI *FtpPI) HandleOPTS() error {
+	option, value := ftpPI.para, ""
+	if idx := strings.IndexByte(option, ' '); idx >= 0 {
+		option, value = option[:idx], strings.TrimSpace(option[idx+1:])
+	}
+	switch strings.ToUpper(option) {
+	case "HASH":
+		return ftpPI.HandleOPTSHASH(value)
+	case "UTF8":
+		return ftpPI.HandleOPTSUTF8(value)
+	default:
+		ftpPI.writeMsgCode(501)
+		return fmt.Errorf("option %v not supported", option)
+	}
+}
+
+// HandleTYPE ...
+func (ftpPI *FtpPI) HandleTYPE() error {
+	switch ftpPI.para {
+	case "I":
+		ftpPI.typeT = TypeBinary
+		ftpPI.dtp.binary = true
+		ftpPI.writeMsg(200, "Set type to binary.")
+	case "A":
+		ftpPI.typeT = TypeASCII
+		ftpPI.dtp.binary = false
+		ftpPI.writeMsg(200, "Set type to ASCII.")
+	default:
+		ftpPI.writeMsgCode(504)
+		return fmt.Errorf("parameter not supported")
+	}
+	return nil
+}
+
+// HandlePASV ...
+func (ftpPI *FtpPI) HandlePASV() error {
+	ip := ftpPI.pasvIP().To4()
+	if ip == nil {
+		ftpPI.writeMsg(425, "Cannot advertise a passive address for this connection.")
+		return fmt.Errorf("no IPv4 passive address for %v", ftpPI.conn.LocalAddr())
+	}
+	err := ftpPI.dtp.SetPassive()
+	if err != nil {
+		ftpPI.writeMsg(451, "Local error in setting passive mode")
+		ftpPI.logger.Error("cannot set passive mode", F("error", err))
+	} else {
+		p1 := ftpPI.dtp.transfer.GetPort() / 256
+		p2 := ftpPI.dtp.transfer.GetPort() - 256*p1
+		ftpPI.writeMsg(227, fmt.Sprintf("Entering Passive Mode (%v,%v,%v,%v,%v,%v).", ip[0], ip[1], ip[2], ip[3], p1, p2))
+	}
+	return err
+}
+
+// pasvIP returns the address clients must connect to for passive transfers
+func (ftpPI *FtpPI) pasvIP() net.IP {
+	host, _, _ := net.SplitHostPort(ftpPI.conn.LocalAddr().String())
+	if ip, ok := ftpPI.settings.pasvIPMap[host]; ok {
+		return ip
+	}
+	if ftpPI.settings.pasvIP != nil {
+		return ftpPI.settings.pasvIP
+	}
+	return net.ParseIP(host)
+}
+
+// HandleLIST ...
+func (ftpPI *FtpPI) HandleLIST() error {
+	return ftpPI.handleList(true)
+}
+
+// HandleCDUP ...
+func (ftpPI *FtpPI) HandleCDUP() error {
+	ftpPI.para = ".."
+	return ftpPI.HandleCWD()
+}
+
+// HandleCWD ...
+func (ftpPI *FtpPI) HandleCWD() error {
+	var path string
+	if ftpPI.para == "" {
+		path = ftpPI.curPath
+	} else if ftpPI.para[0] == '/' {
+		path = ftpPI.dtp.userRootPath + ftpPI.para
+	} else {
+		path = ftpPI.curPath + "/" + ftpPI.para
+	}
+	if !ftpPI.dtp.ValidPath(path) {
+		ftpPI.writeMsgCode(450)
+		return fmt.Errorf("invalid path %v", path)
+	}
+	var err error
+	ftpPI.curPath, err = ftpPI.dtp.AbsPath(path)
+	if err != nil {
+		ftpPI.writeMsgCode(450)
+		return err
+	}
+	newPath := ftpPI.curPath[len(ftpPI.dtp.userRootPath):]
+	if newPath == "" {
+		newPath = "/"
+	}
+	ftpPI.logger.Debug("working directory changed", F("dir", newPath))
+	ftpPI.writeMsg(250, "CD worked on "+newPath)
+	return nil
+}
+
+// HandlePWD ...
+func (ftpPI *FtpPI) HandlePWD() error {
+	if !ftpPI.dtp.ValidPath(ftpPI.curPath) {
+		return fmt.Errorf("invalid working path %v", ftpPI.curPath)
+	}
+	path := ftpPI.curPath[len(ftpPI.dtp.userRootPath):]
+	if path == "" {
+		path = "/"
+	}
+	ftpPI.writeMsg(257, "\""+path+"\" is the current directory")
+	return nil
+}
+
+// HandleRETR ...
+func (ftpPI *FtpPI) HandleRETR() error {
+	var path string
+	if ftpPI.para == "" {
+		path = ftpPI.curPath
+	} else if ftpPI.para[0] == '/' {
+		path = ftpPI.dtp.userRootPath + ftpPI.para
+	} else {
+		path = ftpPI.curPath + "/" + ftpPI.para
+	}
+	if !ftpPI.dtp.ValidPath(path) {
+		ftpPI.writeMsgCode(450)
+		return fmt.Errorf("invalid path %v", path)
+	}
+	ftpPI.writeMsgCode(150)
+	ftpPI.runTransfer(func() error {
+		return ftpPI.dtp.SendFile(path)
+	})
+	return nil
+}
+
+// HandleSTOR ...
+func (ftpPI *FtpPI) HandleSTOR() error {
+	var path string
+	if ftpPI.para == "" {
+		path = ftpPI.curPath
+	} else if ftpPI.para[0] == '/' {
+		path = ftpPI.dtp.userRootPath + ftpPI.para
+	} else {
+		path = ftpPI.curPath + "/" + ftpPI.para
+	}
+	idx := strings.LastIndex(path, "/")
+	if idx <= 0 {
+		ftpPI.writeMsgCode(450)
+		return fmt.Errorf("invalid path %v", path)
+	}
+	fatherPath := path[:idx]
+	if !ftpPI.dtp.ValidPath(fatherPath) || !ftpPI.dtp.IsDir(fatherPath) {
+		ftpPI.writeMsgCode(450)
+		return fmt.Errorf("invalid path %v", path)
+	}
+	storedPath, file, reserved, err := ftpPI.dtp.createUpload(path)
+	if err != nil {
+		ftpPI.replyCreateError(err)
+		return err
+	}
+	if storedPath != path {
+		ftpPI.logger.Info("upload renamed", F("path", path), F("stored", storedPath))
+		ftpPI.writeMsg(150, "FILE: "+uploadName(ftpPI.para, storedPath))
+	} else {
+		ftpPI.writeMsgCode(150)
+	}
+	ftpPI.runTransfer(func() error {
+		return ftpPI.dtp.receiveTo(storedPath, file, reserved)
+	})
+	return nil
+}
+
+// HandleQUIT ...
+func (ftpPI *FtpPI) HandleQUIT() error {
+	// a running transfer completes and gets its reply first, RFC 959 4.1.1
+	ftpPI.waitTransfer(false)
+	ftpPI.writeMsg(221, "Goodbye")
+	ftpPI.conn.Close()
+	ftpPI.logger.Info("session closed by QUIT")
+	return nil
+}
@@ -0,0 +1,170 @@
+package ftpserver
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// Transfer ...
+type Transfer interface {
+	Open() (net.Conn, error)
+	Close() error
+	GetPort() int
+	GetIP() net.IP
+}
+
+// pasvRand picks passive ports, seeded here so embedders need not seed
+// math/rand themselves
+var (
+	pasvRandMutex sync.Mutex
+	pasvRand      = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// PassiveTransfer ...
+type PassiveTransfer struct {
+	tcpListener   *net.TCPListener
+	port          int
+	ip            net.IP
+	connMutex     sync.Mutex
+	conn          net.Conn
+	acceptTimeout time.Duration
+	// peerIP is the only address allowed to connect, nil allows any (FXP)
+	peerIP   net.IP
+	logger   *FtpLogger
+	settings *FtpServerSettings
+	metrics  *FtpMetrics
+	// closeOnce releases the port in metrics once
+	closeOnce sync.Once
+}
+
+// CreatePassiveTransfer listens on a random free port of the passive range
+func CreatePassiveTransfer(settings *FtpServerSettings, peerIP net.IP, logger *FtpLogger, metrics *FtpMetrics) (*PassiveTransfer, error) {
+	transfer := &(PassiveTransfer{tcpListener: nil, port: 0, ip: net.ParseIP("0.0.0.0"), acceptTimeout: settings.pasvTimeout, peerIP: peerIP, logger: logger,
+		settings: settings, metrics: metrics})
+	err := fmt.Errorf("no passive port in [%v, %v]", settings.pasvMinPort, settings.pasvMaxPort)
+	count := settings.pasvMaxPort - settings.pasvMinPort + 1
+	pasvRandMutex.Lock()
+	offsets := pasvRand.Perm(count)
+	pasvRandMutex.Unlock()
+	for _, offset := range offsets {
+		var laddr *net.TCPAddr
+		laddr, err = net.ResolveTCPAddr("tcp", ":"+fmt.Sprintf("%v", settings.pasvMinPort+offset))
+		if err != nil {
+			continue
+		}
+		transfer.tcpListener, err = net.ListenTCP("tcp", laddr)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	transfer.port = transfer.tcpListener.Addr().(*net.TCPAddr).Port
+	transfer.ip = transfer.tcpListener.Addr().(*net.TCPAddr).IP
+	metrics.PassivePortsInUse.Add(1)
+	return transfer, nil
+}
+
+// ResolvePasvIP turns an IPv4 address or a host name into the IPv4 address
+// advertised in PASV replies.
+func ResolvePasvIP(host string) (net.IP, error) {
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip.To4(), nil
+		}
+	}
+	return nil, fmt.Errorf("%v has no IPv4 address", host)
+}
+
+// Open waits for the client to connect, connections from other hosts than
+// the control connection peer are dropped so they cannot steal the transfer.
+func (p *PassiveTransfer) Open() (net.Conn, error) {
+	if p.acceptTimeout > 0 {
+		p.tcpListener.SetDeadline(time.Now().Add(p.acceptTimeout))
+	}
+	p.connMutex.Lock()
+	conn := p.conn
+	p.connMutex.Unlock()
+	for conn == nil {
+		raw, err := p.tcpListener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		conn, err = AcceptProxy(raw, p.settings)
+		if err != nil {
+			p.logger.Warn("invalid PROXY header on passive port", F("port", p.port), F("error", err))
+			raw.Close()
+			continue
+		}
+		if p.peerIP != nil && !p.peerIP.Equal(conn.RemoteAddr().(*net.TCPAddr).IP) {
+			p.logger.Warn("passive connection from another address rejected", F("port", p.port), F("expected", p.peerIP), F("remote", conn.RemoteAddr()))
+			conn.Close()
+			conn = nil
+			continue
+		}
+		p.connMutex.Lock()
+		p.conn = conn
+		p.connMutex.Unlock()
+	}
+	return conn, nil
+}
+
+// Close ...
+func (p *PassiveTransfer) Close() error {
+	if p.tcpListener != nil {
+		p.tcpListener.Close()
+		p.closeOnce.Do(func() {
+			p.metrics.PassivePortsInUse.Add(-1)
+		})
+	}
+	p.connMutex.Lock()
+	defer p.connMutex.Unlock()
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	return nil
+}
+
+// GetPort ...
+func (p *PassiveTransfer) GetPort() int {
+	return p.port
+}
+
+// GetIP ...
+func (p *PassiveTransfer) GetIP() net.IP {
+	return p.ip
+}
+
+// DataConnError is returned when the data connection cannot be opened
+type DataConnError struct {
+	err error
+}
+
+func (e *DataConnError) Error() string {
+	return "cannot open data connection: " + e.err.Error()
+}
+
+// timeoutConn pushes the deadline forward before every read and write,
+// so a transfer only fails when it stalls for the whole timeout.
+type timeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *timeoutConn) Read(b []byte) (int, error) {
+	c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(b)
+}
+
+func (c *timeoutConn) Write(b []byte) (int, error) {
+	c.Conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Write(b)
+}
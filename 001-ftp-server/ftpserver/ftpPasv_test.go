@@ -0,0 +1,147 @@
+package ftpserver
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// createTestLogger logs to a temporary file, removed by the returned func
+func createTestLogger(t *testing.T) (*FtpLogger, func()) {
+	name := writeTempFile(t, "")
+	logger, err := CreateFtpLogger(name, "text", LevelDebug, RotateOptions{})
+	if err != nil {
+		os.Remove(name)
+		t.Fatal(err)
+	}
+	return logger, func() {
+		logger.Close()
+		os.Remove(name)
+	}
+}
+
+// testPasvSettings are the default settings with the passive accept timeout
+func testPasvSettings(pasvTimeout time.Duration) *FtpServerSettings {
+	return &(FtpServerSettings{pasvTimeout: pasvTimeout, pasvMinPort: defaultPasvMinPort, pasvMaxPort: defaultPasvMaxPort,
+		proxyTrusted: &(AccessList{})})
+}
+
+// dialPassive connects to the passive port from the local address ip, the
+// test is skipped when the system cannot bind it
+func dialPassive(t *testing.T, transfer *PassiveTransfer, ip string) net.Conn {
+	dialer := &(net.Dialer{LocalAddr: &(net.TCPAddr{IP: net.ParseIP(ip)}), Timeout: time.Second})
+	conn, err := dialer.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(transfer.GetPort())))
+	if err != nil {
+		t.Skipf("cannot dial from %v: %v", ip, err)
+	}
+	return conn
+}
+
+func TestPassivePeerVerification(t *testing.T) {
+	logger, cleanup := createTestLogger(t)
+	defer cleanup()
+	transfer, err := CreatePassiveTransfer(testPasvSettings(2*time.Second), net.ParseIP("127.0.0.1"), logger, CreateFtpMetrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transfer.Close()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	opened := make(chan result, 1)
+	go func() {
+		conn, err := transfer.Open()
+		opened <- result{conn, err}
+	}()
+	thief := dialPassive(t, transfer, "127.0.0.2")
+	defer thief.Close()
+	thief.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = thief.Read(make([]byte, 1)); err == nil {
+		t.Errorf("the connection from 127.0.0.2 got data")
+	} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		t.Errorf("the connection from 127.0.0.2 was not closed")
+	}
+	client := dialPassive(t, transfer, "127.0.0.1")
+	defer client.Close()
+	r := <-opened
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if ip := r.conn.RemoteAddr().(*net.TCPAddr).IP; !ip.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("Open accepted %v, want the control connection peer 127.0.0.1", ip)
+	}
+}
+
+func TestPassivePeerTimeout(t *testing.T) {
+	logger, cleanup := createTestLogger(t)
+	defer cleanup()
+	transfer, err := CreatePassiveTransfer(testPasvSettings(200*time.Millisecond), net.ParseIP("127.0.0.1"), logger, CreateFtpMetrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transfer.Close()
+	thief := dialPassive(t, transfer, "127.0.0.2")
+	defer thief.Close()
+	if conn, err := transfer.Open(); err == nil {
+		t.Errorf("Open accepted %v, only a foreign peer connected", conn.RemoteAddr())
+	}
+}
+
+func TestPassiveFXP(t *testing.T) {
+	logger, cleanup := createTestLogger(t)
+	defer cleanup()
+	settings := testPasvSettings(2 * time.Second)
+	for _, allowFXP := range []bool{false, true} {
+		dtp, err := CreateFtpDTP(settings, 1, net.ParseIP("127.0.0.1"), logger, nil, nil, CreateFtpMetrics())
+		if err != nil {
+			t.Fatal(err)
+		}
+		dtp.allowFXP = allowFXP
+		if err = dtp.SetPassive(); err != nil {
+			t.Fatal(err)
+		}
+		transfer := dtp.transfer.(*PassiveTransfer)
+		if allowFXP != (transfer.peerIP == nil) {
+			t.Errorf("allowFXP %v: passive peer %v", allowFXP, transfer.peerIP)
+		}
+		if allowFXP {
+			other := dialPassive(t, transfer, "127.0.0.2")
+			conn, err := transfer.Open()
+			if err != nil {
+				t.Errorf("FXP: Open error = %v, want the connection from 127.0.0.2", err)
+			} else if ip := conn.RemoteAddr().(*net.TCPAddr).IP; !ip.Equal(net.ParseIP("127.0.0.2")) {
+				t.Errorf("FXP: Open accepted %v, want 127.0.0.2", ip)
+			}
+			other.Close()
+		}
+		dtp.closeTransfer()
+	}
+}
+
+func TestPassivePortRange(t *testing.T) {
+	logger, cleanup := createTestLogger(t)
+	defer cleanup()
+	settings := testPasvSettings(time.Second)
+	settings.pasvMinPort, settings.pasvMaxPort = 39170, 39172
+	ports := make(map[int]bool)
+	for i := 0; i < 3; i++ {
+		transfer, err := CreatePassiveTransfer(settings, nil, logger, CreateFtpMetrics())
+		if err != nil {
+			t.Fatalf("transfer %v: %v", i, err)
+		}
+		defer transfer.Close()
+		port := transfer.GetPort()
+		if port < settings.pasvMinPort || port > settings.pasvMaxPort || ports[port] {
+			t.Errorf("transfer %v got port %v, want a free one in [39170, 39172]", i, port)
+		}
+		ports[port] = true
+	}
+	if transfer, err := CreatePassiveTransfer(settings, nil, logger, CreateFtpMetrics()); err == nil {
+		transfer.Close()
+		t.Errorf("got port %v, every port of the range is in use", transfer.GetPort())
+	}
+}
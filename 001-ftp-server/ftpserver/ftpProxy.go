@@ -0,0 +1,137 @@
+package ftpserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const proxyHeaderTimeout = 5 * time.Second
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyConn is a connection whose remote address comes from a PROXY header
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+	remote net.Addr
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// AcceptProxy reads the PROXY protocol v1 or v2 header when proxy protocol
+// is enabled and conn comes from a trusted upstream, and returns a
+// connection reporting the real client address. Other connections are
+// returned as they are.
+func AcceptProxy(conn net.Conn, settings *FtpServerSettings) (net.Conn, error) {
+	if !settings.proxyProtocol {
+		return conn, nil
+	}
+	if trusted, _ := settings.proxyTrusted.Check(remoteIP(conn)); !trusted {
+		return conn, nil
+	}
+	conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+	reader := bufio.NewReader(conn)
+	sig, err := reader.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, fmt.Errorf("read PROXY header from %v: %v", conn.RemoteAddr(), err)
+	}
+	var remote net.Addr
+	if bytes.Equal(sig, proxyV2Signature) {
+		remote, err = readProxyV2(reader)
+	} else if bytes.HasPrefix(sig, []byte("PROXY ")) {
+		remote, err = readProxyV1(reader)
+	} else {
+		err = fmt.Errorf("missing PROXY header")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read PROXY header from %v: %v", conn.RemoteAddr(), err)
+	}
+	if remote == nil {
+		remote = conn.RemoteAddr()
+	}
+	return &(proxyConn{conn, reader, remote}), nil
+}
+
+// readProxyV1 parses "PROXY TCP4|TCP6 src dst sport dport\r\n", it returns
+// a nil address for "PROXY UNKNOWN".
+func readProxyV1(reader *bufio.Reader) (net.Addr, error) {
+	line := make([]byte, 0, 107)
+	for len(line) < 107 {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("PROXY v1 header too long")
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid PROXY v1 header %q", strings.TrimSpace(string(line)))
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid PROXY v1 source %v:%v", fields[2], fields[4])
+	}
+	return &(net.TCPAddr{IP: ip, Port: port}), nil
+}
+
+// readProxyV2 parses the binary header, it returns a nil address for LOCAL
+// commands and address families other than TCP over IPv4 or IPv6.
+func readProxyV2(reader *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	_, err := io.ReadFull(reader, header)
+	if err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY version %v", header[12]>>4)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	_, err = io.ReadFull(reader, payload)
+	if err != nil {
+		return nil, err
+	}
+	command := header[12] & 0x0F
+	if command == 0 {
+		return nil, nil
+	}
+	if command != 1 {
+		return nil, fmt.Errorf("unsupported PROXY command %v", command)
+	}
+	switch header[13] {
+	case 0x11:
+		if len(payload) < 12 {
+			return nil, fmt.Errorf("short PROXY v2 TCP4 addresses")
+		}
+		return &(net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}), nil
+	case 0x21:
+		if len(payload) < 36 {
+			return nil, fmt.Errorf("short PROXY v2 TCP6 addresses")
+		}
+		return &(net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}), nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,215 @@
+package ftpserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadProxyV1(t *testing.T) {
+	tests := []struct {
+		header string
+		addr   string
+		err    bool
+	}{
+		{"PROXY TCP4 192.0.2.7 10.0.0.1 51234 21\r\n", "192.0.2.7:51234", false},
+		{"PROXY TCP6 2001:db8::7 2001:db8::1 51234 21\r\n", "[2001:db8::7]:51234", false},
+		{"PROXY UNKNOWN\r\n", "", false},
+		{"PROXY UNKNOWN ff:: ff:: 1 2\r\n", "", false},
+		{"PROXY TCP4 192.0.2.7 10.0.0.1 51234 21\n", "", true},
+		{"PROXY UDP4 192.0.2.7 10.0.0.1 51234 21\r\n", "", true},
+		{"PROXY TCP4 192.0.2.7 10.0.0.1 51234\r\n", "", true},
+		{"PROXY TCP4 not-an-ip 10.0.0.1 51234 21\r\n", "", true},
+		{"PROXY TCP4 192.0.2.7 10.0.0.1 65536 21\r\n", "", true},
+		{"PROXY TCP4 192.0.2.7 10.0.0.1 51234 21" + strings.Repeat(" ", 100) + "\r\n", "", true},
+		{"PROXY TCP4 192.0.2.7", "", true},
+	}
+	for _, test := range tests {
+		reader := bufio.NewReader(strings.NewReader(test.header + "USER ABC\r\n"))
+		addr, err := readProxyV1(reader)
+		if (err != nil) != test.err {
+			t.Errorf("readProxyV1(%q) error = %v, want error %v", test.header, err, test.err)
+			continue
+		}
+		if test.err {
+			continue
+		}
+		if got := addrString(addr); got != test.addr {
+			t.Errorf("readProxyV1(%q) = %v, want %v", test.header, got, test.addr)
+		}
+		if rest, _ := ioutil.ReadAll(reader); string(rest) != "USER ABC\r\n" {
+			t.Errorf("readProxyV1(%q) left %q, want the command", test.header, rest)
+		}
+	}
+}
+
+// proxyV2Header builds a binary header with the version and command byte,
+// the family byte and the address block
+func proxyV2Header(versionCommand, family byte, addresses []byte) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, versionCommand, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:16], uint16(len(addresses)))
+	return append(header, addresses...)
+}
+
+func TestReadProxyV2(t *testing.T) {
+	tcp4 := []byte{192, 0, 2, 7, 10, 0, 0, 1, 0xC8, 0x22, 0, 21}
+	tcp6 := make([]byte, 36)
+	copy(tcp6, net.ParseIP("2001:db8::7"))
+	copy(tcp6[16:], net.ParseIP("2001:db8::1"))
+	binary.BigEndian.PutUint16(tcp6[32:], 51234)
+	binary.BigEndian.PutUint16(tcp6[34:], 21)
+	truncated := proxyV2Header(0x21, 0x11, tcp4)
+	binary.BigEndian.PutUint16(truncated[14:16], 100)
+	tests := []struct {
+		name   string
+		header []byte
+		addr   string
+		err    bool
+	}{
+		{"tcp4", proxyV2Header(0x21, 0x11, tcp4), "192.0.2.7:51234", false},
+		{"tcp6", proxyV2Header(0x21, 0x21, tcp6), "[2001:db8::7]:51234", false},
+		{"tcp4 with TLVs", proxyV2Header(0x21, 0x11, append(tcp4, 0x04, 0, 1, 0)), "192.0.2.7:51234", false},
+		{"local", proxyV2Header(0x20, 0x00, nil), "", false},
+		{"unix", proxyV2Header(0x21, 0x31, make([]byte, 216)), "", false},
+		{"version 1", proxyV2Header(0x11, 0x11, tcp4), "", true},
+		{"unknown command", proxyV2Header(0x22, 0x11, tcp4), "", true},
+		{"short tcp4", proxyV2Header(0x21, 0x11, tcp4[:8]), "", true},
+		{"short tcp6", proxyV2Header(0x21, 0x21, tcp6[:32]), "", true},
+		{"truncated", truncated, "", true},
+	}
+	for _, test := range tests {
+		reader := bufio.NewReader(bytes.NewReader(append(test.header, "USER ABC\r\n"...)))
+		addr, err := readProxyV2(reader)
+		if (err != nil) != test.err {
+			t.Errorf("%v: readProxyV2 error = %v, want error %v", test.name, err, test.err)
+			continue
+		}
+		if test.err {
+			continue
+		}
+		if got := addrString(addr); got != test.addr {
+			t.Errorf("%v: readProxyV2 = %v, want %v", test.name, got, test.addr)
+		}
+		if rest, _ := ioutil.ReadAll(reader); string(rest) != "USER ABC\r\n" {
+			t.Errorf("%v: readProxyV2 left %q, want the command", test.name, rest)
+		}
+	}
+}
+
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+// tcpPair returns both ends of a loopback TCP connection, the server end
+// first
+func tcpPair(t *testing.T) (net.Conn, net.Conn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := listener.Accept()
+	if err != nil {
+		client.Close()
+		t.Fatal(err)
+	}
+	return server, client
+}
+
+func TestAcceptProxy(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		trusted string
+		header  []byte
+		addr    string
+		err     bool
+	}{
+		{"disabled", false, "127.0.0.0/8", []byte("PROXY TCP4 192.0.2.7 10.0.0.1 51234 21\r\n"), "", false},
+		{"untrusted", true, "10.0.0.0/8", []byte("PROXY TCP4 192.0.2.7 10.0.0.1 51234 21\r\n"), "", false},
+		{"trusted v1", true, "127.0.0.0/8", []byte("PROXY TCP4 192.0.2.7 10.0.0.1 51234 21\r\n"), "192.0.2.7:51234", false},
+		{"trusted v2", true, "127.0.0.0/8", proxyV2Header(0x21, 0x11, []byte{192, 0, 2, 7, 10, 0, 0, 1, 0xC8, 0x22, 0, 21}), "192.0.2.7:51234", false},
+		{"trusted local", true, "127.0.0.0/8", proxyV2Header(0x20, 0x00, nil), "", false},
+		{"trusted without header", true, "127.0.0.0/8", nil, "", true},
+		{"trusted bad header", true, "127.0.0.0/8", []byte("PROXY TCP4 192.0.2.7\r\n"), "", true},
+	}
+	for _, test := range tests {
+		settings := &(FtpServerSettings{proxyProtocol: test.enabled, proxyTrusted: &(AccessList{})})
+		settings.proxyTrusted.Add(true, test.trusted)
+		server, client := tcpPair(t)
+		client.Write(append(append([]byte{}, test.header...), "USER ABC\r\n"...))
+		client.(*net.TCPConn).CloseWrite()
+		conn, err := AcceptProxy(server, settings)
+		if (err != nil) != test.err {
+			t.Errorf("%v: AcceptProxy error = %v, want error %v", test.name, err, test.err)
+		} else if err == nil {
+			addr := test.addr
+			rest := "USER ABC\r\n"
+			if addr == "" {
+				addr = server.RemoteAddr().String()
+			}
+			if test.header != nil && (!test.enabled || test.trusted != "127.0.0.0/8") {
+				rest = string(test.header) + rest
+			}
+			if got := conn.RemoteAddr().String(); got != addr {
+				t.Errorf("%v: RemoteAddr = %v, want %v", test.name, got, addr)
+			}
+			buf := make([]byte, len(rest))
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			if _, err = io.ReadFull(conn, buf); err != nil || string(buf) != rest {
+				t.Errorf("%v: read %q, %v, want %q", test.name, buf, err, rest)
+			}
+		}
+		server.Close()
+		client.Close()
+	}
+}
+
+func TestProxySession(t *testing.T) {
+	ftpServer, addr, cleanup := startTestServer(t, func(config *FtpConfig) {
+		config.Proxy.Enabled = true
+		config.Proxy.Trusted = []string{"127.0.0.1/32"}
+	})
+	defer cleanup()
+
+	// a trusted peer sending a bad header is dropped, and the server goes on
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("PROXY TCP4 bogus\r\n"))
+	if n, err := conn.Read(make([]byte, 64)); err == nil {
+		t.Errorf("read %v bytes after a bad PROXY header, want the connection closed", n)
+	}
+	checkMetrics(t, scrape(ftpServer.metrics), []string{`myftp_connections_rejected_total{reason="proxy"} 1`})
+
+	conn, err = net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("PROXY TCP4 192.0.2.7 127.0.0.1 40000 21\r\n"))
+	client := &(testClient{t, conn, bufio.NewReader(conn)})
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	client.expect(220)
+	client.login()
+	if sessions := ftpServer.Sessions(); len(sessions) != 1 || sessions[0].RemoteAddr != "192.0.2.7:40000" {
+		t.Errorf("sessions = %+v, want the client of the PROXY header", sessions)
+	}
+}
@@ -0,0 +1,201 @@
+package ftpserver
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// RotateOptions ...
+type RotateOptions struct {
+	// MaxSize rotates the file before it grows past that many bytes, 0 disables it
+	MaxSize int64
+	// Interval rotates the file once it was written for that long, 0 disables it
+	Interval time.Duration
+	// MaxBackups is the number of rotated files kept
+	MaxBackups int
+	// Compress gzips rotated files in the background
+	Compress bool
+}
+
+// RotatingFile is an append-only file renamed to name.1, name.2 ... (with a
+// .gz suffix when compressed) on rotation, the MaxBackups most recent old
+// files are kept.
+type RotatingFile struct {
+	mutex   sync.Mutex
+	name    string
+	options RotateOptions
+	file    *os.File
+	size    int64
+	opened  time.Time
+	// compressing is done once the last rotated file is compressed, the
+	// next rotation waits for it before renaming backups
+	compressing sync.WaitGroup
+}
+
+// OpenRotatingFile opens name for appending
+func OpenRotatingFile(name string, options RotateOptions) (*RotatingFile, error) {
+	rotatingFile := &(RotatingFile{name: name, options: options})
+	err := rotatingFile.open()
+	if err != nil {
+		return nil, err
+	}
+	return rotatingFile, nil
+}
+
+func (rotatingFile *RotatingFile) open() error {
+	file, err := os.OpenFile(rotatingFile.name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	rotatingFile.file = file
+	rotatingFile.size = fileInfo.Size()
+	rotatingFile.opened = time.Now()
+	return nil
+}
+
+// Write appends p, rotating first when the file is due
+func (rotatingFile *RotatingFile) Write(p []byte) (int, error) {
+	rotatingFile.mutex.Lock()
+	defer rotatingFile.mutex.Unlock()
+	if rotatingFile.file == nil {
+		return 0, os.ErrClosed
+	}
+	if rotatingFile.due(int64(len(p))) {
+		err := rotatingFile.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := rotatingFile.file.Write(p)
+	rotatingFile.size += int64(n)
+	return n, err
+}
+
+// due reports whether the file must be rotated before writing n bytes,
+// an empty file is never rotated
+func (rotatingFile *RotatingFile) due(n int64) bool {
+	if rotatingFile.size == 0 {
+		return false
+	}
+	options := rotatingFile.options
+	if options.MaxSize > 0 && rotatingFile.size+n > options.MaxSize {
+		return true
+	}
+	return options.Interval > 0 && time.Since(rotatingFile.opened) >= options.Interval
+}
+
+// Rotate moves the current file aside and starts a new one
+func (rotatingFile *RotatingFile) Rotate() error {
+	rotatingFile.mutex.Lock()
+	defer rotatingFile.mutex.Unlock()
+	if rotatingFile.file == nil {
+		return os.ErrClosed
+	}
+	return rotatingFile.rotate()
+}
+
+// Reopen closes and reopens the file by name, for external tools such as
+// logrotate which move the file away themselves
+func (rotatingFile *RotatingFile) Reopen() error {
+	rotatingFile.mutex.Lock()
+	defer rotatingFile.mutex.Unlock()
+	if rotatingFile.file == nil {
+		return os.ErrClosed
+	}
+	rotatingFile.file.Close()
+	rotatingFile.file = nil
+	return rotatingFile.open()
+}
+
+func (rotatingFile *RotatingFile) rotate() error {
+	rotatingFile.file.Close()
+	rotatingFile.file = nil
+	rotatingFile.compressing.Wait()
+	maxBackups := rotatingFile.options.MaxBackups
+	if maxBackups <= 0 {
+		os.Remove(rotatingFile.name)
+		return rotatingFile.open()
+	}
+	os.Remove(rotatingFile.backupName(maxBackups))
+	os.Remove(rotatingFile.backupName(maxBackups) + ".gz")
+	for i := maxBackups - 1; i >= 1; i-- {
+		os.Rename(rotatingFile.backupName(i), rotatingFile.backupName(i+1))
+		os.Rename(rotatingFile.backupName(i)+".gz", rotatingFile.backupName(i+1)+".gz")
+	}
+	backup := rotatingFile.backupName(1)
+	err := os.Rename(rotatingFile.name, backup)
+	if err == nil && rotatingFile.options.Compress {
+		rotatingFile.compressing.Add(1)
+		go func() {
+			defer rotatingFile.compressing.Done()
+			compressFile(backup)
+		}()
+	}
+	return rotatingFile.open()
+}
+
+func (rotatingFile *RotatingFile) backupName(i int) string {
+	return fmt.Sprintf("%v.%v", rotatingFile.name, i)
+}
+
+// compressFile replaces name by name.gz, name is kept if anything fails
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp := name + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmp, name+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(name)
+}
+
+// Sync ...
+func (rotatingFile *RotatingFile) Sync() error {
+	rotatingFile.mutex.Lock()
+	defer rotatingFile.mutex.Unlock()
+	if rotatingFile.file == nil {
+		return os.ErrClosed
+	}
+	return rotatingFile.file.Sync()
+}
+
+// Close closes the file once the last rotated file is compressed
+func (rotatingFile *RotatingFile) Close() error {
+	rotatingFile.mutex.Lock()
+	defer rotatingFile.mutex.Unlock()
+	rotatingFile.compressing.Wait()
+	if rotatingFile.file == nil {
+		return os.ErrClosed
+	}
+	err := rotatingFile.file.Close()
+	rotatingFile.file = nil
+	return err
+}
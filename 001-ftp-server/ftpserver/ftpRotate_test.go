@@ -0,0 +1,129 @@
+package ftpserver
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// createTempDir returns a temporary directory, removed by the returned func
+func createTempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "myftp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, cleanup := createTempDir(t)
+	defer cleanup()
+	name := filepath.Join(dir, "xferlog")
+	file, err := OpenRotatingFile(name, RotateOptions{MaxSize: 12, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n", "five\n", "six\n", "seven\n"} {
+		if _, err = file.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file.Close()
+	if _, err = file.Write([]byte("closed\n")); err == nil {
+		t.Errorf("Write after Close succeeded")
+	}
+	for suffix, want := range map[string]string{"": "seven\n", ".1": "five\nsix\n", ".2": "three\nfour\n"} {
+		if data, err := ioutil.ReadFile(name + suffix); err != nil || string(data) != want {
+			t.Errorf("xferlog%v = %q, %v, want %q", suffix, data, err, want)
+		}
+	}
+	if _, err = os.Stat(name + ".3"); err == nil {
+		t.Errorf("more than 2 backups kept")
+	}
+}
+
+func TestRotatingFileCompress(t *testing.T) {
+	dir, cleanup := createTempDir(t)
+	defer cleanup()
+	name := filepath.Join(dir, "log")
+	file, err := OpenRotatingFile(name, RotateOptions{MaxSize: 8, MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		file.Write([]byte(line))
+	}
+	file.Close()
+	for suffix, want := range map[string]string{".1.gz": "second\n", ".2.gz": "first\n"} {
+		src, err := os.Open(name + suffix)
+		if err != nil {
+			t.Errorf("log%v: %v", suffix, err)
+			continue
+		}
+		zr, err := gzip.NewReader(src)
+		if err == nil {
+			var data []byte
+			data, err = ioutil.ReadAll(zr)
+			if string(data) != want {
+				t.Errorf("log%v = %q, want %q", suffix, data, want)
+			}
+		}
+		if err != nil {
+			t.Errorf("log%v: %v", suffix, err)
+		}
+		src.Close()
+	}
+	for _, suffix := range []string{".1", ".2", ".1.gz.tmp"} {
+		if _, err = os.Stat(name + suffix); err == nil {
+			t.Errorf("log%v left after compression", suffix)
+		}
+	}
+}
+
+func TestRotatingFileInterval(t *testing.T) {
+	dir, cleanup := createTempDir(t)
+	defer cleanup()
+	name := filepath.Join(dir, "log")
+	file, err := OpenRotatingFile(name, RotateOptions{Interval: 50 * time.Millisecond, MaxBackups: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("old\n"))
+	file.Write([]byte("same file\n"))
+	time.Sleep(80 * time.Millisecond)
+	file.Write([]byte("new\n"))
+	file.Close()
+	for suffix, want := range map[string]string{"": "new\n", ".1": "old\nsame file\n"} {
+		if data, err := ioutil.ReadFile(name + suffix); err != nil || string(data) != want {
+			t.Errorf("log%v = %q, %v, want %q", suffix, data, err, want)
+		}
+	}
+}
+
+func TestRotatingFileReopen(t *testing.T) {
+	dir, cleanup := createTempDir(t)
+	defer cleanup()
+	name := filepath.Join(dir, "log")
+	file, err := OpenRotatingFile(name, RotateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("before\n"))
+	os.Rename(name, name+".moved")
+	if err = file.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("after\n"))
+	file.Close()
+	if err = file.Reopen(); err == nil {
+		t.Errorf("Reopen after Close succeeded")
+	}
+	for suffix, want := range map[string]string{"": "after\n", ".moved": "before\n"} {
+		if data, err := ioutil.ReadFile(name + suffix); err != nil || string(data) != want {
+			t.Errorf("log%v = %q, %v, want %q", suffix, data, err, want)
+		}
+	}
+}
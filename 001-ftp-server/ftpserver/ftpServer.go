@@ -0,0 +1,379 @@
+// Package ftpserver implements a FTP server which can be embedded in other
+// programs, with pluggable authentication and storage.
+package ftpserver
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultIdleTimeout     = 5 * time.Minute
+	defaultLoginTimeout    = time.Minute
+	defaultPasvTimeout     = 30 * time.Second
+	defaultTransferTimeout = 5 * time.Minute
+
+	defaultPasvMinPort = 2122
+	defaultPasvMaxPort = 2200
+
+	defaultShutdownGrace = 30 * time.Second
+
+	defaultMaxLoginAttempts = 3
+	defaultLoginFailDelay   = time.Second
+	defaultBanFailures      = 10
+	defaultBanDuration      = 15 * time.Minute
+
+	defaultHookRetries    = 3
+	defaultHookRetryDelay = time.Second
+	defaultHookTimeout    = 10 * time.Second
+	defaultHookQueueSize  = 1000
+)
+
+// FtpServerSettings is the validated form of FtpConfig used at runtime
+type FtpServerSettings struct {
+	listenAddrs   []string
+	rootDir       string
+	authenticator Authenticator
+	storage       Storage
+	accessFile    string
+	logFile       string
+	logFormat     string
+	logLevel      LogLevel
+	logRotate     RotateOptions
+	// xferLogFile is written in the xferlog format when set
+	xferLogFile   string
+	xferLogRotate RotateOptions
+	// idleTimeout closes a control connection without commands, 0 disables it
+	idleTimeout time.Duration
+	// loginTimeout closes a control connection not logged in since it was accepted
+	loginTimeout time.Duration
+	// pasvTimeout bounds the wait for the client to connect to the passive port
+	pasvTimeout time.Duration
+	// transferTimeout aborts a transfer whose data connection makes no progress
+	transferTimeout time.Duration
+	// maxLoginAttempts disconnects a session after that many failed PASS
+	maxLoginAttempts int
+	// loginFailDelay is multiplied by the failures of the session before replying to a failed PASS
+	loginFailDelay time.Duration
+	// banFailures failed logins from one IP ban it for banDuration, 0 disables bans
+	banFailures int
+	banDuration time.Duration
+	// passive ports are picked at random in [pasvMinPort, pasvMaxPort]
+	pasvMinPort int
+	pasvMaxPort int
+	// pasvIP is advertised in PASV replies instead of the control connection
+	// local address, pasvIPMap overrides it per local address
+	pasvIP    net.IP
+	pasvIPMap map[string]net.IP
+	// proxyProtocol reads a PROXY header on connections from proxyTrusted
+	proxyProtocol bool
+	proxyTrusted  *AccessList
+	// overwrite is the policy of STOR on existing files, overwriteDirs
+	// overrides it for directories and their subdirectories
+	overwrite     OverwritePolicy
+	overwriteDirs map[string]OverwritePolicy
+	// hooks receive the events of the sessions
+	hooks HookOptions
+}
+
+// FtpServer ...
+type FtpServer struct {
+	logger   *FtpLogger
+	xferLog  *FtpXferLog
+	hooks    *FtpHooks
+	metrics  *FtpMetrics
+	settings *FtpServerSettings
+	bans     *FtpBanList
+	// access is replaced as a whole by Reload
+	accessMutex sync.RWMutex
+	access      *AccessList
+	// mutex guards the listeners and sessions to close on Shutdown, and
+	// draining which Shutdown sets, serving counts the running accept loops
+	mutex     sync.Mutex
+	listeners []net.Listener
+	serving   int
+	sessions  map[*FtpPI]bool
+	draining  bool
+	clients   sync.WaitGroup
+	// lastSessionID numbers sessions in log lines, it is updated atomically
+	lastSessionID uint64
+	// siteCommands are the SITE subcommands by name
+	siteMutex    sync.RWMutex
+	siteCommands map[string]*Command
+}
+
+// CreateFtpServer validates the configuration and opens the log file
+func CreateFtpServer(config *FtpConfig) (*FtpServer, error) {
+	settings, err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+	ftpServer := &(FtpServer{logger: nil, settings: nil, bans: nil, metrics: CreateFtpMetrics(), sessions: make(map[*FtpPI]bool),
+		siteCommands: make(map[string]*Command)})
+	ftpServer.registerBuiltinSiteCommands()
+	ftpServer.logger, err = CreateFtpLogger(settings.logFile, settings.logFormat, settings.logLevel, settings.logRotate)
+	if err != nil {
+		return nil, err
+	}
+	if settings.xferLogFile != "" {
+		ftpServer.xferLog, err = CreateFtpXferLog(settings.xferLogFile, settings.xferLogRotate)
+		if err != nil {
+			ftpServer.logger.Close()
+			return nil, err
+		}
+	}
+	ftpServer.settings = settings
+	ftpServer.hooks = CreateFtpHooks(settings.hooks, ftpServer.logger, ftpServer.metrics)
+	ftpServer.bans = CreateFtpBanList(settings.banFailures, settings.banDuration)
+	err = ftpServer.Reload()
+	if err != nil {
+		return nil, err
+	}
+	ftpServer.logger.Info("FTP server created", F("root", settings.rootDir))
+	return ftpServer, nil
+}
+
+// Reload re-reads the server access rules, accounts are read by the
+// authenticator on every login so they need no reload.
+func (ftpServer *FtpServer) Reload() error {
+	access, err := CreateAccessListFromFile(ftpServer.settings.accessFile)
+	if err != nil {
+		ftpServer.logger.Error("cannot load access rules", F("file", ftpServer.settings.accessFile), F("error", err))
+		return err
+	}
+	ftpServer.accessMutex.Lock()
+	ftpServer.access = access
+	ftpServer.accessMutex.Unlock()
+	ftpServer.logger.Info("access rules loaded", F("file", ftpServer.settings.accessFile))
+	return nil
+}
+
+// ReopenLogs reopens the log files by name, to be called once an external
+// tool such as logrotate moved them
+func (ftpServer *FtpServer) ReopenLogs() error {
+	err := ftpServer.logger.Reopen()
+	if e := ftpServer.xferLog.Reopen(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	ftpServer.logger.Info("log files reopened")
+	return nil
+}
+
+// Metrics returns the metrics of the server, which is a http.Handler
+// serving them in the Prometheus text format
+func (ftpServer *FtpServer) Metrics() *FtpMetrics {
+	return ftpServer.metrics
+}
+
+// CheckAccess ...
+func (ftpServer *FtpServer) CheckAccess(ip string) (bool, string) {
+	ftpServer.accessMutex.RLock()
+	defer ftpServer.accessMutex.RUnlock()
+	return ftpServer.access.Check(ip)
+}
+
+// ListenAndServe listens on every configured address and serves them like
+// Serve, it returns nil after Shutdown.
+func (ftpServer *FtpServer) ListenAndServe() error {
+	listeners := make([]net.Listener, 0, len(ftpServer.settings.listenAddrs))
+	for _, addr := range ftpServer.settings.listenAddrs {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			ftpServer.logger.Error("cannot start listener", F("addr", addr), F("error", err))
+			for _, l := range listeners {
+				l.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, listener)
+	}
+	errs := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			errs <- ftpServer.Serve(listener)
+		}(listener)
+	}
+	var err error
+	for range listeners {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Serve accepts clients on listener until it fails or Shutdown is called,
+// it returns nil after Shutdown. Shutdown closes the listener.
+func (ftpServer *FtpServer) Serve(listener net.Listener) error {
+	if !ftpServer.addListener(listener) {
+		listener.Close()
+		return nil
+	}
+	defer ftpServer.stopServing()
+	ftpServer.logger.Info("FTP server listening", F("addr", listener.Addr()))
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ftpServer.isDraining() {
+				ftpServer.logger.Info("FTP server stops accepting", F("addr", listener.Addr()))
+				return nil
+			}
+			ftpServer.logger.Error("FTP server accept failed", F("addr", listener.Addr()), F("error", err))
+			return err
+		}
+		ftpServer.metrics.ConnectionsAccepted.Inc()
+		ftpServer.clients.Add(1)
+		go ftpServer.handleClient(conn)
+		ftpServer.logger.Debug("client accepted", F("remote", conn.RemoteAddr()))
+	}
+}
+
+// Shutdown stops accepting clients, closes idle sessions with a 421 and
+// waits for running commands such as transfers to finish. When ctx is done
+// first the remaining sessions are closed and ctx.Err() is returned. The
+// queued events are delivered within ctx, then the logger is closed.
+func (ftpServer *FtpServer) Shutdown(ctx context.Context) error {
+	ftpServer.mutex.Lock()
+	ftpServer.draining = true
+	sessions := make([]*FtpPI, 0, len(ftpServer.sessions))
+	for pi := range ftpServer.sessions {
+		sessions = append(sessions, pi)
+	}
+	for _, listener := range ftpServer.listeners {
+		listener.Close()
+	}
+	ftpServer.mutex.Unlock()
+	ftpServer.logger.Info("FTP server shutting down", F("sessions", len(sessions)))
+	for _, pi := range sessions {
+		pi.Drain()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ftpServer.clients.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+		ftpServer.logger.Info("FTP server drained all sessions")
+	case <-ctx.Done():
+		err = ctx.Err()
+		ftpServer.mutex.Lock()
+		for pi := range ftpServer.sessions {
+			pi.Close()
+		}
+		ftpServer.mutex.Unlock()
+		ftpServer.logger.Warn("FTP server grace period expired, closed remaining sessions")
+	}
+	ftpServer.hooks.Close(ctx)
+	ftpServer.xferLog.Close()
+	ftpServer.logger.Close()
+	return err
+}
+
+func (ftpServer *FtpServer) nextSessionID() uint64 {
+	return atomic.AddUint64(&ftpServer.lastSessionID, 1)
+}
+
+// addListener registers a listener for Shutdown, it fails once the server
+// is draining
+func (ftpServer *FtpServer) addListener(listener net.Listener) bool {
+	ftpServer.mutex.Lock()
+	defer ftpServer.mutex.Unlock()
+	if ftpServer.draining {
+		return false
+	}
+	ftpServer.listeners = append(ftpServer.listeners, listener)
+	ftpServer.serving++
+	return true
+}
+
+func (ftpServer *FtpServer) stopServing() {
+	ftpServer.mutex.Lock()
+	defer ftpServer.mutex.Unlock()
+	ftpServer.serving--
+}
+
+func (ftpServer *FtpServer) isDraining() bool {
+	ftpServer.mutex.Lock()
+	defer ftpServer.mutex.Unlock()
+	return ftpServer.draining
+}
+
+// addSession registers a session, it fails once the server is draining
+func (ftpServer *FtpServer) addSession(pi *FtpPI) bool {
+	ftpServer.mutex.Lock()
+	defer ftpServer.mutex.Unlock()
+	if ftpServer.draining {
+		return false
+	}
+	ftpServer.sessions[pi] = true
+	ftpServer.metrics.SessionsActive.Add(1)
+	return true
+}
+
+func (ftpServer *FtpServer) removeSession(pi *FtpPI) {
+	ftpServer.mutex.Lock()
+	defer ftpServer.mutex.Unlock()
+	delete(ftpServer.sessions, pi)
+	ftpServer.metrics.SessionsActive.Add(-1)
+}
+
+// handleClient serves a connection accepted on raw, the client address
+// comes from its PROXY header when there is one
+func (ftpServer *FtpServer) handleClient(raw net.Conn) {
+	defer ftpServer.clients.Done()
+	defer raw.Close()
+	setOOBInline(raw)
+	proxied, err := AcceptProxy(raw, ftpServer.settings)
+	if err != nil {
+		ftpServer.metrics.ConnectionsRejected.Inc("proxy")
+		ftpServer.logger.Warn("invalid PROXY header", F("remote", raw.RemoteAddr()), F("error", err))
+		return
+	}
+	ip := remoteIP(proxied)
+	if allowed, rule := ftpServer.CheckAccess(ip); !allowed {
+		proxied.Write([]byte("421 Service not available for your address.\r\n"))
+		ftpServer.metrics.ConnectionsRejected.Inc("access")
+		ftpServer.logger.Warn("access denied", F("ip", ip), F("rule", rule))
+		return
+	}
+	if banned, until := ftpServer.bans.IsBanned(ip); banned {
+		proxied.Write([]byte("421 Too many failed logins, try again later.\r\n"))
+		ftpServer.metrics.ConnectionsRejected.Inc("ban")
+		ftpServer.logger.Warn("banned address rejected", F("ip", ip), F("until", until.Format(time.RFC3339)))
+		return
+	}
+	pi, err := CreateFtpPI(proxied, ftpServer)
+	if err != nil {
+		tmpWriter := bufio.NewWriter(proxied)
+		tmpWriter.Write([]byte(fmt.Sprintf("500 Server Internal Error %s\r\n", err.Error())))
+		tmpWriter.Flush()
+		return
+	}
+	if !ftpServer.addSession(pi) {
+		pi.closeDrained()
+		ftpServer.metrics.ConnectionsRejected.Inc("draining")
+		return
+	}
+	defer ftpServer.removeSession(pi)
+	pi.Serve()
+}
+
+// remoteIP returns the IP of the remote end of a connection without the port
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
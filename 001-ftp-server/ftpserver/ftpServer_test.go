@@ -0,0 +1,263 @@
+package ftpserver
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createTestConfig returns the default configuration pointed at a temporary
+// root with the account "ABC 12345678" and the file hello.txt, the returned
+// func removes the files.
+func createTestConfig(t *testing.T) (*FtpConfig, func()) {
+	dir, err := ioutil.TempDir("", "myftp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultFtpConfig()
+	config.RootDir = filepath.Join(dir, "root")
+	config.AccountFile = filepath.Join(dir, "accounts")
+	config.AccessFile = filepath.Join(dir, "access")
+	config.Log.File = filepath.Join(dir, "log")
+	config.Listen.Addresses = []string{"127.0.0.1:2121"}
+	config.Limits.LoginFailDelay = 0
+	os.Mkdir(config.RootDir, 0777)
+	ioutil.WriteFile(filepath.Join(config.RootDir, "hello.txt"), []byte("hello\n"), 0666)
+	ioutil.WriteFile(config.AccountFile, []byte("ABC 12345678 /ABC\n"), 0666)
+	return config, func() { os.RemoveAll(dir) }
+}
+
+// startTestServer serves the test configuration, changed by configure
+// when not nil, on a free loopback port. The returned func removes the
+// files but does not shut the server down.
+func startTestServer(t *testing.T, configure func(*FtpConfig)) (*FtpServer, string, func()) {
+	config, cleanup := createTestConfig(t)
+	if configure != nil {
+		configure(config)
+	}
+	ftpServer, err := CreateFtpServer(config)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	go ftpServer.Serve(listener)
+	return ftpServer, listener.Addr().String(), cleanup
+}
+
+// testClient is a control connection reading one reply line at a time
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialTestClient(t *testing.T, addr string) *testClient {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	client := &(testClient{t, conn, bufio.NewReader(conn)})
+	client.expect(220)
+	return client
+}
+
+// expect reads a reply line and fails unless it has the code
+func (client *testClient) expect(code int) string {
+	line, err := client.reader.ReadString('\n')
+	if err != nil {
+		client.t.Fatalf("waiting for %v: %v", code, err)
+	}
+	if !strings.HasPrefix(line, fmt.Sprintf("%v ", code)) {
+		client.t.Fatalf("got %q, want %v", line, code)
+	}
+	// the standard texts of some codes span several lines
+	if text := ReplyMap[code]; strings.Contains(text, "\r\n") && strings.HasPrefix(text, line[4:len(line)-2]+"\r\n") {
+		for i := strings.Count(text, "\r\n"); i > 0; i-- {
+			client.reader.ReadString('\n')
+		}
+	}
+	return strings.TrimSpace(line)
+}
+
+func (client *testClient) cmd(line string, code int) string {
+	fmt.Fprintf(client.conn, "%v\r\n", line)
+	return client.expect(code)
+}
+
+// expectClosed fails unless the server closed the connection
+func (client *testClient) expectClosed() {
+	if line, err := client.reader.ReadString('\n'); err == nil {
+		client.t.Fatalf("got %q, want the connection closed", line)
+	}
+}
+
+// pasv sends PASV and returns the advertised data address
+func (client *testClient) pasv() string {
+	reply := client.cmd("PASV", 227)
+	var h1, h2, h3, h4, p1, p2 int
+	if _, err := fmt.Sscanf(reply[strings.Index(reply, "(")+1:], "%d,%d,%d,%d,%d,%d", &h1, &h2, &h3, &h4, &p1, &p2); err != nil {
+		client.t.Fatalf("cannot parse %q: %v", reply, err)
+	}
+	return fmt.Sprintf("%v.%v.%v.%v:%v", h1, h2, h3, h4, p1*256+p2)
+}
+
+// login logs in as ABC
+func (client *testClient) login() {
+	client.cmd("USER ABC", 331)
+	client.cmd("PASS 12345678", 230)
+}
+
+// retr downloads path over a passive data connection
+func (client *testClient) retr(path string) string {
+	dataAddr := client.pasv()
+	client.cmd("RETR "+path, 150)
+	data, err := net.Dial("tcp", dataAddr)
+	if err != nil {
+		client.t.Fatal(err)
+	}
+	defer data.Close()
+	content, err := ioutil.ReadAll(data)
+	if err != nil {
+		client.t.Fatal(err)
+	}
+	client.expect(226)
+	return string(content)
+}
+
+// stor uploads content to path over a passive data connection
+func (client *testClient) stor(path string, content string) {
+	dataAddr := client.pasv()
+	client.cmd("STOR "+path, 150)
+	data, err := net.Dial("tcp", dataAddr)
+	if err != nil {
+		client.t.Fatal(err)
+	}
+	io.WriteString(data, content)
+	data.Close()
+	client.expect(226)
+}
+
+// startRETR logs in and leaves the session waiting in RETR for the data
+// connection, it returns the data address
+func (client *testClient) startRETR() string {
+	client.login()
+	addr := client.pasv()
+	client.cmd("RETR hello.txt", 150)
+	return addr
+}
+
+func TestShutdownDrain(t *testing.T) {
+	ftpServer, addr, cleanup := startTestServer(t, nil)
+	defer cleanup()
+	idle := dialTestClient(t, addr)
+	defer idle.conn.Close()
+	busy := dialTestClient(t, addr)
+	defer busy.conn.Close()
+	dataAddr := busy.startRETR()
+
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- ftpServer.Shutdown(ctx)
+	}()
+	idle.expect(421)
+	idle.expectClosed()
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned %v during a transfer", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Errorf("the server still accepts clients")
+	}
+
+	data, err := net.Dial("tcp", dataAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(data)
+	data.Close()
+	if err != nil || string(content) != "hello\n" {
+		t.Errorf("RETR got %q, %v, want the file", content, err)
+	}
+	busy.expect(226)
+	busy.expect(421)
+	busy.expectClosed()
+	if err = <-shutdown; err != nil {
+		t.Errorf("Shutdown = %v, want nil", err)
+	}
+}
+
+func TestShutdownGraceExpired(t *testing.T) {
+	ftpServer, addr, cleanup := startTestServer(t, nil)
+	defer cleanup()
+	busy := dialTestClient(t, addr)
+	defer busy.conn.Close()
+	busy.startRETR()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := ftpServer.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown = %v, want %v", err, context.DeadlineExceeded)
+	}
+	for {
+		if _, err := busy.reader.ReadString('\n'); err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				t.Errorf("the busy session was not closed")
+			}
+			break
+		}
+	}
+}
+
+func TestDrainStalledClient(t *testing.T) {
+	config, cleanup := createTestConfig(t)
+	defer cleanup()
+	ftpServer, err := CreateFtpServer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nothing reads the client end of the pipe, so the 421 cannot be written
+	server, client := net.Pipe()
+	defer client.Close()
+	pi, err := CreateFtpPI(server, ftpServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drained := make(chan struct{})
+	go func() {
+		pi.Drain()
+		close(drained)
+	}()
+	info := make(chan SessionInfo)
+	go func() { info <- pi.Info() }()
+	select {
+	case <-info:
+	case <-time.After(time.Second):
+		t.Errorf("Drain holds the session state while writing")
+	}
+	select {
+	case <-drained:
+	case <-time.After(noticeWriteTimeout + 5*time.Second):
+		t.Fatalf("Drain blocked on a client which does not read")
+	}
+	if _, err = client.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("read after Drain = %v, want the session closed", err)
+	}
+}
@@ -0,0 +1,115 @@
+package ftpserver
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// SessionInfo describes a session for the admin API
+type SessionInfo struct {
+	ID          uint64        `json:"id"`
+	RemoteAddr  string        `json:"remote_addr"`
+	User        string        `json:"user"`
+	Dir         string        `json:"dir"`
+	Command     string        `json:"command"`
+	Started     time.Time     `json:"started"`
+	IdleSeconds float64       `json:"idle_seconds"`
+	Transfer    *TransferInfo `json:"transfer,omitempty"`
+	lastActive  time.Time
+}
+
+// TransferInfo describes the running RETR or STOR of a session, Size is -1
+// when unknown
+type TransferInfo struct {
+	File      string  `json:"file"`
+	Direction string  `json:"direction"`
+	Bytes     int64   `json:"bytes"`
+	Size      int64   `json:"size"`
+	Seconds   float64 `json:"seconds"`
+}
+
+// Info returns the state of the session, the user and directory are
+// updated after each command
+func (ftpPI *FtpPI) Info() SessionInfo {
+	ftpPI.stateMutex.Lock()
+	info := ftpPI.info
+	ftpPI.stateMutex.Unlock()
+	ftpPI.dtp.transferMutex.Lock()
+	progress := ftpPI.dtp.progress
+	ftpPI.dtp.transferMutex.Unlock()
+	if info.Command == "" && progress == nil {
+		info.IdleSeconds = time.Since(info.lastActive).Seconds()
+	}
+	if progress != nil {
+		direction := "sent"
+		if progress.incoming {
+			direction = "received"
+		}
+		info.Transfer = &(TransferInfo{File: progress.path, Direction: direction,
+			Bytes: atomic.LoadInt64(&progress.bytes), Size: progress.size, Seconds: time.Since(progress.start).Seconds()})
+	}
+	return info
+}
+
+// Kick closes the session and its data connection with a 421, whose write
+// gives up after noticeWriteTimeout
+func (ftpPI *FtpPI) Kick() {
+	ftpPI.conn.SetWriteDeadline(time.Now().Add(noticeWriteTimeout))
+	ftpPI.writeMsg(421, "Disconnected by the administrator.")
+	ftpPI.Close()
+}
+
+// Broadcast queues msg, it is sent before the next reply of the session
+func (ftpPI *FtpPI) Broadcast(msg string) {
+	ftpPI.writeMutex.Lock()
+	defer ftpPI.writeMutex.Unlock()
+	for _, line := range strings.Split(strings.Replace(msg, "\r", "", -1), "\n") {
+		ftpPI.pending = append(ftpPI.pending, line)
+	}
+}
+
+// Sessions lists the open sessions by ID
+func (ftpServer *FtpServer) Sessions() []SessionInfo {
+	infos := make([]SessionInfo, 0)
+	for _, pi := range ftpServer.sessionList() {
+		infos = append(infos, pi.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// Kick closes the session with the given ID, it reports whether it existed
+func (ftpServer *FtpServer) Kick(id uint64) bool {
+	for _, pi := range ftpServer.sessionList() {
+		if pi.id == id {
+			pi.Kick()
+			ftpServer.logger.Info("session kicked", F("session", id))
+			return true
+		}
+	}
+	return false
+}
+
+// Broadcast queues msg for every open session and returns their number
+func (ftpServer *FtpServer) Broadcast(msg string) int {
+	sessions := ftpServer.sessionList()
+	for _, pi := range sessions {
+		pi.Broadcast(msg)
+	}
+	ftpServer.logger.Info("message broadcast", F("sessions", len(sessions)), F("message", msg))
+	return len(sessions)
+}
+
+func (ftpServer *FtpServer) sessionList() []*FtpPI {
+	ftpServer.mutex.Lock()
+	defer ftpServer.mutex.Unlock()
+	sessions := make([]*FtpPI, 0, len(ftpServer.sessions))
+	for pi := range ftpServer.sessions {
+		sessions = append(sessions, pi)
+	}
+	return sessions
+}
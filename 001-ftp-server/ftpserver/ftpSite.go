@@ -0,0 +1,139 @@
+package ftpserver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RegisterSiteCommand adds a SITE subcommand, or replaces the one with the
+// same name, including the built-in CHARSET, CHMOD, HELP, IDLE, UMASK and WHO. The handler gets
+// what follows the subcommand name and replies with Reply.
+func (ftpServer *FtpServer) RegisterSiteCommand(command Command) error {
+	if command.Name == "" || strings.ContainsAny(command.Name, " \t") || command.Handler == nil {
+		return fmt.Errorf("SITE command needs a name without spaces and a handler")
+	}
+	command.Name = strings.ToUpper(command.Name)
+	command.quit = false
+	if command.Syntax == "" {
+		command.Syntax = "SITE " + command.Name
+	}
+	ftpServer.siteMutex.Lock()
+	defer ftpServer.siteMutex.Unlock()
+	ftpServer.siteCommands[command.Name] = &command
+	return nil
+}
+
+// siteCommand looks up a SITE subcommand
+func (ftpServer *FtpServer) siteCommand(name string) (*Command, bool) {
+	ftpServer.siteMutex.RLock()
+	defer ftpServer.siteMutex.RUnlock()
+	command, ok := ftpServer.siteCommands[strings.ToUpper(name)]
+	return command, ok
+}
+
+func (ftpServer *FtpServer) registerBuiltinSiteCommands() {
+	for _, command := range []Command{
+		{Name: "HELP", Syntax: "SITE HELP [<command>]", Help: "List the SITE commands or show the usage of one.",
+			Handler: (*FtpPI).HandleSITEHELP},
+		{Name: "IDLE", NeedAuth: true, Syntax: "SITE IDLE [<seconds>]", Help: "Show or set the idle timeout of the session.",
+			Handler: (*FtpPI).HandleSITEIDLE},
+		{Name: "CHARSET", NeedAuth: true, Syntax: "SITE CHARSET [<charset>]", Help: "Show or set the encoding of file names.",
+			Handler: (*FtpPI).HandleSITECHARSET},
+		{Name: "CHMOD", NeedAuth: true, Args: ArgsRequired, Syntax: "SITE CHMOD <mode> <path>",
+			Help: "Change the permissions of a file, in octal.", Handler: (*FtpPI).HandleSITECHMOD},
+		{Name: "UMASK", NeedAuth: true, Syntax: "SITE UMASK [<mask>]", Help: "Show or set the umask of uploaded files, in octal.",
+			Handler: (*FtpPI).HandleSITEUMASK},
+		{Name: "WHO", NeedAuth: true, Args: ArgsNone, Syntax: "SITE WHO", Help: "List the open sessions.",
+			Handler: (*FtpPI).HandleSITEWHO},
+	} {
+		ftpServer.RegisterSiteCommand(command)
+	}
+}
+
+// HandleSITE dispatches "SITE <command> [<args>]" to its subcommand
+func (ftpPI *FtpPI) HandleSITE(args string) error {
+	name, rest := args, ""
+	if idx := strings.IndexByte(args, ' '); idx >= 0 {
+		name, rest = args[:idx], strings.TrimSpace(args[idx+1:])
+	}
+	command, ok := ftpPI.server.siteCommand(name)
+	if !ok {
+		ftpPI.writeMsg(502, fmt.Sprintf("Unknown SITE command %v.", name))
+		return fmt.Errorf("SITE command %v not supported", name)
+	}
+	if err := command.check(ftpPI, rest); err != nil {
+		return err
+	}
+	return command.Handler(ftpPI, rest)
+}
+
+// HandleSITEHELP ...
+func (ftpPI *FtpPI) HandleSITEHELP(args string) error {
+	if args != "" {
+		command, ok := ftpPI.server.siteCommand(args)
+		if !ok {
+			ftpPI.writeMsg(502, fmt.Sprintf("Unknown SITE command %v.", args))
+			return fmt.Errorf("no help for SITE %v", args)
+		}
+		ftpPI.writeMsg(214, fmt.Sprintf("Syntax: %v - %v", command.Syntax, command.Help))
+		return nil
+	}
+	ftpPI.server.siteMutex.RLock()
+	lines := commandColumns(ftpPI.server.siteCommands)
+	ftpPI.server.siteMutex.RUnlock()
+	ftpPI.writeLine(multiLine(214, "The following SITE commands are recognized:", lines, "Help OK."))
+	return nil
+}
+
+// HandleSITEIDLE shows or sets the idle timeout of the session, it cannot
+// exceed the one of the server
+func (ftpPI *FtpPI) HandleSITEIDLE(args string) error {
+	if args == "" {
+		ftpPI.writeMsg(200, fmt.Sprintf("Current idle timeout is %v seconds.", int(ftpPI.getIdleTimeout().Seconds())))
+		return nil
+	}
+	seconds, err := strconv.Atoi(args)
+	if err != nil || seconds <= 0 {
+		ftpPI.writeMsg(501, "Syntax: SITE IDLE [<seconds>]")
+		return fmt.Errorf("invalid idle timeout %q", args)
+	}
+	timeout := time.Duration(seconds) * time.Second
+	if max := ftpPI.settings.idleTimeout; max > 0 && timeout > max {
+		ftpPI.writeMsg(501, fmt.Sprintf("Idle timeout cannot exceed %v seconds.", int(max.Seconds())))
+		return fmt.Errorf("idle timeout %v above %v", timeout, max)
+	}
+	ftpPI.stateMutex.Lock()
+	ftpPI.idleTimeout = timeout
+	ftpPI.stateMutex.Unlock()
+	ftpPI.writeMsg(200, fmt.Sprintf("Idle timeout set to %v seconds.", seconds))
+	return nil
+}
+
+// HandleSITEWHO lists the sessions with their user, address and idle time,
+// for accounts with site_who=yes only
+func (ftpPI *FtpPI) HandleSITEWHO(args string) error {
+	if !ftpPI.allowWho {
+		ftpPI.writeMsg(550, "Permission denied.")
+		return fmt.Errorf("user %v cannot list sessions", ftpPI.user)
+	}
+	sessions := ftpPI.server.Sessions()
+	lines := make([]string, 0, len(sessions))
+	for _, info := range sessions {
+		user := info.User
+		if user == "" {
+			user = "-"
+		}
+		lines = append(lines, fmt.Sprintf("%-6v %-12v %-22v idle %v", info.ID, user, info.RemoteAddr,
+			time.Duration(info.IdleSeconds)*time.Second))
+	}
+	ftpPI.writeLine(multiLine(211, fmt.Sprintf("%v sessions:", len(sessions)), lines, "End of list"))
+	return nil
+}
+
+func (ftpPI *FtpPI) getIdleTimeout() time.Duration {
+	ftpPI.stateMutex.Lock()
+	defer ftpPI.stateMutex.Unlock()
+	return ftpPI.idleTimeout
+}
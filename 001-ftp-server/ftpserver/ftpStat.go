@@ -0,0 +1,92 @@
+package ftpserver
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// HandleSTAT replies the status of the session, or lists a path over the
+// control connection. It may run during a transfer.
+func (ftpPI *FtpPI) HandleSTAT() error {
+	if ftpPI.para == "" {
+		ftpPI.writeLine(multiLine(211, "MyFTP server status:", ftpPI.status(), "End of status"))
+		return nil
+	}
+	if !ftpPI.auth {
+		ftpPI.writeMsgCode(530)
+		return fmt.Errorf("user not log in")
+	}
+	options, arg := parseListArgs(ftpPI.para)
+	options.Long = true
+	filePath, prefix, err := ftpPI.listPath(arg)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	dir, entries, err := ftpPI.dtp.listEntries(filePath, prefix, options)
+	if err == nil {
+		err = ftpPI.dtp.writeEntries(&buf, entries, false, options)
+	}
+	if err == nil && options.Recursive {
+		err = ftpPI.dtp.writeTree(&buf, dir, entries, options)
+	}
+	if err != nil {
+		ftpPI.writeMsgCode(450)
+		return err
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n")
+	if buf.Len() == 0 {
+		lines = nil
+	}
+	ftpPI.writeLine(multiLine(213, "Status of "+arg+":", lines, "End of status"))
+	return nil
+}
+
+// status lists the user, TYPE, data connection, transferred bytes and
+// uptime of the session
+func (ftpPI *FtpPI) status() []string {
+	lines := []string{"Connected from " + remoteIP(ftpPI.conn)}
+	if ftpPI.auth {
+		lines = append(lines, "Logged in as "+ftpPI.user)
+	} else {
+		lines = append(lines, "Not logged in")
+	}
+	if ftpPI.dtp.binary {
+		lines = append(lines, "TYPE: BINARY")
+	} else {
+		lines = append(lines, "TYPE: ASCII")
+	}
+	ftpPI.dtp.transferMutex.Lock()
+	transfer := ftpPI.dtp.transfer
+	ftpPI.dtp.transferMutex.Unlock()
+	if info := ftpPI.Info().Transfer; info != nil {
+		size := "unknown size"
+		if info.Size >= 0 {
+			size = fmt.Sprintf("%v bytes", info.Size)
+		}
+		lines = append(lines, fmt.Sprintf("Transfer in progress: %v %v of %v, %v bytes so far", info.Direction, info.File, size, info.Bytes))
+	} else if transfer != nil {
+		lines = append(lines, fmt.Sprintf("Passive mode, listening on port %v", transfer.GetPort()))
+	} else {
+		lines = append(lines, "No data connection")
+	}
+	lines = append(lines, fmt.Sprintf("Bytes sent: %v, received: %v",
+		atomic.LoadInt64(&ftpPI.dtp.bytesSent), atomic.LoadInt64(&ftpPI.dtp.bytesReceived)))
+	uptime := time.Since(ftpPI.start) / time.Second * time.Second
+	lines = append(lines, fmt.Sprintf("Session uptime: %v", uptime))
+	return lines
+}
+
+// multiLine formats a reply of RFC 959 section 4.2, the lines are indented
+// so none can be taken for its end
+func multiLine(code int, first string, lines []string, last string) string {
+	reply := []string{fmt.Sprintf("%v-%v", code, first)}
+	for _, line := range lines {
+		reply = append(reply, " "+line)
+	}
+	reply = append(reply, fmt.Sprintf("%v %v", code, last))
+	return strings.Join(reply, "\r\n")
+}
@@ -0,0 +1,84 @@
+package ftpserver
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMultiLine(t *testing.T) {
+	got := multiLine(211, "Status:", []string{"one", "211 two"}, "End")
+	if want := "211-Status:\r\n one\r\n 211 two\r\n211 End"; got != want {
+		t.Errorf("multiLine = %q, want %q", got, want)
+	}
+}
+
+// multi sends a command and returns the lines of its multi-line reply
+// between the first and the last, without their indentation
+func (client *testClient) multi(command string, code int) []string {
+	fmt.Fprintf(client.conn, "%v\r\n", command)
+	first, err := client.reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(first, fmt.Sprintf("%v-", code)) {
+		client.t.Fatalf("%v: got %q, %v, want a multi-line %v reply", command, first, err, code)
+	}
+	var lines []string
+	for {
+		line, err := client.reader.ReadString('\n')
+		if err != nil {
+			client.t.Fatalf("%v: %v", command, err)
+		}
+		if strings.HasPrefix(line, fmt.Sprintf("%v ", code)) {
+			return lines
+		}
+		lines = append(lines, strings.TrimSpace(line))
+	}
+}
+
+// hasLine reports whether one of lines starts with prefix
+func hasLine(lines []string, prefix string) bool {
+	for _, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSTAT(t *testing.T) {
+	_, addr, cleanup := startTestServer(t, nil)
+	defer cleanup()
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	if lines := client.multi("STAT", 211); !hasLine(lines, "Connected from 127.0.0.1") || !hasLine(lines, "Not logged in") {
+		t.Errorf("STAT before login = %q", lines)
+	}
+	client.cmd("STAT hello.txt", 530)
+	client.login()
+	client.retr("hello.txt")
+	client.cmd("TYPE A", 200)
+	lines := client.multi("STAT", 211)
+	for _, want := range []string{"Logged in as ABC", "TYPE: ASCII", "No data connection", "Bytes sent: 6, received: 0", "Session uptime: "} {
+		if !hasLine(lines, want) {
+			t.Errorf("STAT = %q, want a line %q", lines, want)
+		}
+	}
+	dataAddr := client.pasv()
+	port := dataAddr[strings.LastIndex(dataAddr, ":")+1:]
+	if lines = client.multi("STAT", 211); !hasLine(lines, "Passive mode, listening on port "+port) {
+		t.Errorf("STAT after PASV = %q, want port %v", lines, port)
+	}
+
+	if lines = client.multi("STAT hello.txt", 213); len(lines) != 1 || !strings.HasSuffix(lines[0], " hello.txt") {
+		t.Errorf("STAT hello.txt = %q, want its long line", lines)
+	}
+	if lines = client.multi("STAT *.none", 213); len(lines) != 0 {
+		t.Errorf("STAT *.none = %q, want no lines", lines)
+	}
+	client.cmd("STAT missing.txt", 450)
+
+	// STAT answers while RETR waits for its data connection
+	client.cmd("RETR hello.txt", 150)
+	client.multi("STAT", 211)
+	client.cmd("ABOR", 426)
+	client.expect(226)
+}
@@ -0,0 +1,113 @@
+package ftpserver
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Storage is the file system sessions read and write. Paths are absolute,
+// slash separated and always below the configured root directory, which
+// the server checks before calling it.
+type Storage interface {
+	Stat(path string) (os.FileInfo, error)
+	ReadDir(path string) ([]os.FileInfo, error)
+	Open(path string) (io.ReadCloser, error)
+	Create(path string) (io.WriteCloser, error)
+}
+
+// ModTimeSetter is implemented by a Storage which can change the
+// modification time of a file, MFMT calls it
+type ModTimeSetter interface {
+	SetModTime(path string, modTime time.Time) error
+}
+
+// CreationTimeSetter is implemented by a Storage which can change the
+// creation time of a file, MFCT calls it
+type CreationTimeSetter interface {
+	SetCreationTime(path string, createTime time.Time) error
+}
+
+// Chmoder is implemented by a Storage which can change the permissions of
+// a file, SITE CHMOD and the umask of accounts need it
+type Chmoder interface {
+	Chmod(path string, mode os.FileMode) error
+}
+
+// ExclusiveCreator is implemented by a Storage which can create a file
+// only when it does not exist, failing with an error os.IsExist accepts.
+// Uploads which must not overwrite use it to avoid races.
+type ExclusiveCreator interface {
+	CreateNew(path string) (io.WriteCloser, error)
+}
+
+// Remover is implemented by a Storage which can remove a file, uploads
+// use it to free the name they reserved when no data arrives
+type Remover interface {
+	Remove(path string) error
+}
+
+// DirMaker is implemented by a Storage which can create a directory, MKD
+// needs it
+type DirMaker interface {
+	Mkdir(path string, mode os.FileMode) error
+}
+
+// LocalStorage stores files in the local file system
+type LocalStorage struct{}
+
+// Stat ...
+func (LocalStorage) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+// ReadDir ...
+func (LocalStorage) ReadDir(path string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(path)
+}
+
+// Open ...
+func (LocalStorage) Open(path string) (io.ReadCloser, error) {
+	return os.OpenFile(path, os.O_RDONLY, 0666)
+}
+
+// CheckWritable creates and removes a temporary file in dir
+func (LocalStorage) CheckWritable(dir string) error {
+	file, err := ioutil.TempFile(dir, ".myftp-readyz")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// SetModTime also sets the access time to now
+func (LocalStorage) SetModTime(path string, modTime time.Time) error {
+	return os.Chtimes(path, time.Now(), modTime)
+}
+
+// Chmod ...
+func (LocalStorage) Chmod(path string, mode os.FileMode) error {
+	return os.Chmod(path, mode)
+}
+
+// CreateNew ...
+func (LocalStorage) CreateNew(path string) (io.WriteCloser, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+}
+
+// Mkdir ...
+func (LocalStorage) Mkdir(path string, mode os.FileMode) error {
+	return os.Mkdir(path, mode)
+}
+
+// Remove ...
+func (LocalStorage) Remove(path string) error {
+	return os.Remove(path)
+}
+
+// Create creates path, or truncates it when it exists
+func (LocalStorage) Create(path string) (io.WriteCloser, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+}
@@ -0,0 +1,23 @@
+package ftpserver
+
+import (
+	"syscall"
+	"time"
+)
+
+// SetCreationTime is only available on Windows, other file systems do not
+// let the creation time be changed
+func (LocalStorage) SetCreationTime(path string, createTime time.Time) error {
+	pathp, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+	handle, err := syscall.CreateFile(pathp, syscall.FILE_WRITE_ATTRIBUTES, syscall.FILE_SHARE_WRITE, nil,
+		syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(handle)
+	filetime := syscall.NsecToFiletime(createTime.UnixNano())
+	return syscall.SetFileTime(handle, &filetime, nil, nil)
+}
@@ -0,0 +1,104 @@
+package ftpserver
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// timeFormat is the time-val of RFC 3659, always in UTC
+const timeFormat = "20060102150405"
+
+// parseTimeVal parses YYYYMMDDHHMMSS with optional fractions of a second
+func parseTimeVal(value string) (time.Time, error) {
+	fraction := ""
+	if idx := strings.IndexByte(value, '.'); idx >= 0 {
+		value, fraction = value[:idx], value[idx:]
+	}
+	if len(value) != len(timeFormat) || len(fraction) == 1 || len(fraction) > 10 {
+		return time.Time{}, fmt.Errorf("invalid time %v%v", value, fraction)
+	}
+	return time.ParseInLocation(timeFormat+fractionLayout(fraction), value+fraction, time.UTC)
+}
+
+// fractionLayout is the layout of a fraction such as ".123", "" for none
+func fractionLayout(fraction string) string {
+	if fraction == "" {
+		return ""
+	}
+	return "." + strings.Repeat("0", len(fraction)-1)
+}
+
+// timeFeatures are the FEAT lines of MDTM, MFMT and MFCT, the latter two
+// only when the storage can set the time
+func (ftpPI *FtpPI) timeFeatures() []string {
+	features := []string{"MDTM"}
+	if _, ok := ftpPI.dtp.storage.(ModTimeSetter); ok {
+		features = append(features, "MFMT")
+	}
+	if _, ok := ftpPI.dtp.storage.(CreationTimeSetter); ok {
+		features = append(features, "MFCT")
+	}
+	return features
+}
+
+// HandleMDTM replies the modification time of a file
+func (ftpPI *FtpPI) HandleMDTM() error {
+	path, err := ftpPI.filePath(ftpPI.para)
+	if err != nil {
+		return err
+	}
+	fileInfo, err := ftpPI.dtp.storage.Stat(path)
+	if err != nil {
+		ftpPI.writeMsg(550, "File not found.")
+		return err
+	}
+	ftpPI.writeMsg(213, fileInfo.ModTime().UTC().Format(timeFormat))
+	return nil
+}
+
+// HandleMFMT sets the modification time of a file, "MFMT <time> <file>"
+func (ftpPI *FtpPI) HandleMFMT() error {
+	setter, ok := ftpPI.dtp.storage.(ModTimeSetter)
+	if !ok {
+		ftpPI.writeMsgCode(502)
+		return fmt.Errorf("storage cannot set modification times")
+	}
+	return ftpPI.setFileTime("Modify", setter.SetModTime)
+}
+
+// HandleMFCT sets the creation time of a file, "MFCT <time> <file>"
+func (ftpPI *FtpPI) HandleMFCT() error {
+	setter, ok := ftpPI.dtp.storage.(CreationTimeSetter)
+	if !ok {
+		ftpPI.writeMsgCode(502)
+		return fmt.Errorf("storage cannot set creation times")
+	}
+	return ftpPI.setFileTime("Create", setter.SetCreationTime)
+}
+
+// setFileTime parses "<time> <file>", calls set and replies
+// "213 <fact>=<time>; <file>"
+func (ftpPI *FtpPI) setFileTime(fact string, set func(string, time.Time) error) error {
+	fields := strings.SplitN(ftpPI.para, " ", 2)
+	if len(fields) != 2 {
+		ftpPI.writeMsgCode(501)
+		return fmt.Errorf("invalid arguments %q", ftpPI.para)
+	}
+	t, err := parseTimeVal(fields[0])
+	if err != nil {
+		ftpPI.writeMsgCode(501)
+		return err
+	}
+	path, err := ftpPI.filePath(fields[1])
+	if err != nil {
+		return err
+	}
+	if err = set(path, t); err != nil {
+		ftpPI.writeMsg(550, "Cannot change the file time.")
+		return err
+	}
+	ftpPI.dtp.fireEvent(Event{Type: EventSetTime, File: path})
+	ftpPI.writeMsg(213, fmt.Sprintf("%v=%v; %v", fact, t.Format(timeFormat), fields[1]))
+	return nil
+}
@@ -0,0 +1,108 @@
+package ftpserver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimeVal(t *testing.T) {
+	tests := []struct {
+		value string
+		time  time.Time
+		err   bool
+	}{
+		{"20200102030405", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), false},
+		{"20200102030405.5", time.Date(2020, 1, 2, 3, 4, 5, 500000000, time.UTC), false},
+		{"20200102030405.123", time.Date(2020, 1, 2, 3, 4, 5, 123000000, time.UTC), false},
+		{"20200102030405.123456789", time.Date(2020, 1, 2, 3, 4, 5, 123456789, time.UTC), false},
+		{"19991231235960", time.Time{}, true},
+		{"20200102030405.", time.Time{}, true},
+		{"20200102030405.1234567891", time.Time{}, true},
+		{"20200102030405.12a", time.Time{}, true},
+		{"202001020304", time.Time{}, true},
+		{"2020010203040506", time.Time{}, true},
+		{"20201302030405", time.Time{}, true},
+		{"2020-01-02T03:04:05", time.Time{}, true},
+		{"", time.Time{}, true},
+	}
+	for _, test := range tests {
+		got, err := parseTimeVal(test.value)
+		if (err != nil) != test.err {
+			t.Errorf("parseTimeVal(%q) error = %v, want error %v", test.value, err, test.err)
+			continue
+		}
+		if !got.Equal(test.time) || got.Location() != time.UTC {
+			t.Errorf("parseTimeVal(%q) = %v, want %v", test.value, got, test.time)
+		}
+	}
+}
+
+func TestMFMT(t *testing.T) {
+	var root string
+	_, addr, cleanup := startTestServer(t, func(config *FtpConfig) {
+		root = config.RootDir
+		ioutil.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0666)
+		ioutil.WriteFile(filepath.Join(root, "b c.txt"), []byte("b"), 0666)
+	})
+	defer cleanup()
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.cmd("MFMT 20200102030405 /a.txt", 530)
+	client.login()
+	tests := []struct {
+		para  string
+		code  int
+		reply string
+		file  string
+		time  time.Time
+	}{
+		{"20200102030405 /a.txt", 213, "213 Modify=20200102030405; /a.txt", "a.txt",
+			time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"19700101000001.250 b c.txt", 213, "213 Modify=19700101000001; b c.txt", "b c.txt",
+			time.Date(1970, 1, 1, 0, 0, 1, 250000000, time.UTC)},
+		{"20200102030405", 501, "", "", time.Time{}},
+		{"2020 /a.txt", 501, "", "", time.Time{}},
+		{"20200102030405 /missing.txt", 550, "", "", time.Time{}},
+		{"20200102030405 /../a.txt", 550, "", "", time.Time{}},
+	}
+	for _, test := range tests {
+		reply := client.cmd("MFMT "+test.para, test.code)
+		if test.reply != "" && reply != test.reply {
+			t.Errorf("MFMT %v: got %q, want %q", test.para, reply, test.reply)
+		}
+		if test.file == "" {
+			continue
+		}
+		fileInfo, err := os.Stat(filepath.Join(root, test.file))
+		if err != nil {
+			t.Errorf("MFMT %v: %v", test.para, err)
+		} else if !fileInfo.ModTime().Equal(test.time) {
+			t.Errorf("MFMT %v: modification time %v, want %v", test.para, fileInfo.ModTime(), test.time)
+		}
+	}
+	if reply := client.cmd("MDTM /a.txt", 213); reply != "213 20200102030405" {
+		t.Errorf("MDTM /a.txt: got %q", reply)
+	}
+	client.cmd("MDTM missing.txt", 550)
+
+	client.conn.Write([]byte("FEAT\r\n"))
+	features := make(map[string]bool)
+	for {
+		line, err := client.reader.ReadString('\n')
+		if err != nil || strings.HasPrefix(line, "211 ") {
+			break
+		}
+		features[strings.TrimSpace(line)] = true
+	}
+	if !features["MDTM"] || !features["MFMT"] || features["MFCT"] != (runtime.GOOS == "windows") {
+		t.Errorf("FEAT = %v, want MDTM, MFMT and MFCT only on Windows", features)
+	}
+	if runtime.GOOS != "windows" {
+		client.cmd("MFCT 20200102030405 /a.txt", 502)
+	}
+}
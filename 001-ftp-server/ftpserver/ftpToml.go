@@ -0,0 +1,224 @@
+package ftpserver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tomlValue is a parsed value with the line it was found on
+type tomlValue struct {
+	value interface{}
+	line  int
+}
+
+// tomlParser parses the subset of TOML used by configuration files:
+// [section] headers, key = value pairs whose values are strings, integers,
+// booleans or arrays of those, and # comments. Values are keyed by
+// "section.key", or "key" before the first section.
+type tomlParser struct {
+	data string
+	pos  int
+	line int
+}
+
+func parseToml(data string) (map[string]tomlValue, error) {
+	p := &(tomlParser{data, 0, 1})
+	values := make(map[string]tomlValue)
+	section := ""
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return values, nil
+		}
+		if p.peek() == '[' {
+			p.pos++
+			p.skipBlank(false)
+			name := p.bareKey()
+			p.skipBlank(false)
+			if name == "" || p.eof() || p.peek() != ']' {
+				return nil, p.errorf("invalid section header")
+			}
+			p.pos++
+			section = name
+		} else {
+			line := p.line
+			key := p.bareKey()
+			if key == "" {
+				return nil, p.errorf("expected a key")
+			}
+			p.skipBlank(false)
+			if p.eof() || p.peek() != '=' {
+				return nil, p.errorf("expected = after %v", key)
+			}
+			p.pos++
+			p.skipBlank(false)
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			if section != "" {
+				key = section + "." + key
+			}
+			if _, ok := values[key]; ok {
+				return nil, fmt.Errorf("line %v: duplicate key %v", line, key)
+			}
+			values[key] = tomlValue{value, line}
+		}
+		p.skipBlank(false)
+		if !p.eof() && p.peek() != '\n' {
+			return nil, p.errorf("unexpected %q", p.peek())
+		}
+	}
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.data)
+}
+
+func (p *tomlParser) peek() byte {
+	return p.data[p.pos]
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %v: %v", p.line, fmt.Sprintf(format, args...))
+}
+
+// skipBlank skips spaces and comments, and newlines too when newlines is set
+func (p *tomlParser) skipBlank(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && newlines:
+			p.pos++
+			p.line++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) bareKey() string {
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			break
+		}
+		p.pos++
+	}
+	return p.data[start:p.pos]
+}
+
+func (p *tomlParser) value() (interface{}, error) {
+	if p.eof() {
+		return nil, p.errorf("missing value")
+	}
+	switch c := p.peek(); {
+	case c == '"':
+		return p.basicString()
+	case c == '\'':
+		end := strings.IndexAny(p.data[p.pos+1:], "'\n")
+		if end < 0 || p.data[p.pos+1+end] != '\'' {
+			return nil, p.errorf("unterminated string")
+		}
+		s := p.data[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return s, nil
+	case c == '[':
+		return p.array()
+	case strings.HasPrefix(p.data[p.pos:], "true"):
+		p.pos += 4
+		return true, nil
+	case strings.HasPrefix(p.data[p.pos:], "false"):
+		p.pos += 5
+		return false, nil
+	default:
+		start := p.pos
+		for !p.eof() && strings.IndexByte("+-0123456789_", p.peek()) >= 0 {
+			p.pos++
+		}
+		n, err := strconv.ParseInt(strings.Replace(p.data[start:p.pos], "_", "", -1), 10, 64)
+		if err != nil || start == p.pos {
+			return nil, p.errorf("invalid value")
+		}
+		return n, nil
+	}
+}
+
+func (p *tomlParser) basicString() (string, error) {
+	p.pos++
+	var buf []byte
+	for !p.eof() {
+		c := p.peek()
+		p.pos++
+		switch c {
+		case '"':
+			return string(buf), nil
+		case '\n':
+			return "", p.errorf("unterminated string")
+		case '\\':
+			if p.eof() {
+				return "", p.errorf("unterminated string")
+			}
+			e := p.peek()
+			p.pos++
+			switch e {
+			case '"', '\\':
+				buf = append(buf, e)
+			case 'n':
+				buf = append(buf, '\n')
+			case 't':
+				buf = append(buf, '\t')
+			case 'r':
+				buf = append(buf, '\r')
+			case 'u':
+				if p.pos+4 > len(p.data) {
+					return "", p.errorf("invalid escape")
+				}
+				r, err := strconv.ParseUint(p.data[p.pos:p.pos+4], 16, 32)
+				if err != nil {
+					return "", p.errorf("invalid escape")
+				}
+				p.pos += 4
+				buf = append(buf, string(rune(r))...)
+			default:
+				return "", p.errorf("invalid escape \\%c", e)
+			}
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *tomlParser) array() ([]interface{}, error) {
+	p.pos++
+	values := make([]interface{}, 0)
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.peek() == ']' {
+			p.pos++
+			return values, nil
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		p.skipBlank(true)
+		if !p.eof() && p.peek() == ',' {
+			p.pos++
+		} else if p.eof() || p.peek() != ']' {
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package ftpserver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// transferCommands open a data connection, they run in the background so
+// the control connection is still read during the transfer
+var transferCommands = map[string]bool{"LIST": true, "NLST": true, "RETR": true, "STOR": true, "STOU": true}
+
+// commandsDuringTransfer may run while a transfer is in progress
+var commandsDuringTransfer = map[string]bool{"ABOR": true, "NOOP": true, "QUIT": true, "STAT": true}
+
+// Telnet bytes sent by clients around ABOR, see RFC 959 section 4.1.3
+const (
+	telnetIAC  = 0xFF
+	telnetWILL = 0xFB
+	telnetDONT = 0xFE
+)
+
+// stripTelnet removes Telnet commands such as IP (IAC 0xF4) and Synch
+// (IAC DM) from a command line, IAC IAC stands for a 0xFF byte
+func stripTelnet(line string) string {
+	if strings.IndexByte(line, telnetIAC) < 0 {
+		return line
+	}
+	out := make([]byte, 0, len(line))
+	for i := 0; i < len(line); i++ {
+		if line[i] != telnetIAC {
+			out = append(out, line[i])
+			continue
+		}
+		i++
+		switch {
+		case i >= len(line):
+		case line[i] == telnetIAC:
+			out = append(out, telnetIAC)
+		case line[i] >= telnetWILL && line[i] <= telnetDONT:
+			// option negotiation carries one more byte
+			i++
+		}
+	}
+	return string(out)
+}
+
+// transferring reports whether a transfer runs in the background
+func (ftpPI *FtpPI) transferring() bool {
+	ftpPI.stateMutex.Lock()
+	defer ftpPI.stateMutex.Unlock()
+	return ftpPI.transferDone != nil
+}
+
+// checkDuringTransfer rejects the command when it cannot run alongside the
+// running transfer
+func (ftpPI *FtpPI) checkDuringTransfer() error {
+	if commandsDuringTransfer[ftpPI.comm] || !ftpPI.transferring() {
+		return nil
+	}
+	if transferCommands[ftpPI.comm] || ftpPI.comm == "PASV" {
+		ftpPI.writeMsg(450, "Another transfer is in progress.")
+	} else {
+		ftpPI.writeMsg(503, "Transfer in progress, only ABOR, NOOP, QUIT and STAT are allowed.")
+	}
+	return fmt.Errorf("command %v during a transfer", ftpPI.comm)
+}
+
+// runTransfer runs transfer in the background after its 150 reply, then
+// replies 226, or 426 when it was aborted, or the error of the transfer.
+// The transfer logs with the logger of the DTP, which keeps the context of
+// its command.
+func (ftpPI *FtpPI) runTransfer(transfer func() error) {
+	ftpPI.runBackground(func() int {
+		err := transfer()
+		switch {
+		case err != nil && ftpPI.isAborted():
+			ftpPI.writeMsgCode(426)
+			ftpPI.dtp.logger.Info("transfer aborted")
+			return 426
+		case err != nil:
+			return ftpPI.writeTransferError(err)
+		}
+		ftpPI.writeMsg(226, "Transfer complete.")
+		return 226
+	})
+}
+
+// runBackground runs work like a transfer, the control connection is read
+// meanwhile and ABOR waits for it. work writes the last reply of the
+// command and returns its code.
+func (ftpPI *FtpPI) runBackground(work func() int) {
+	done := make(chan struct{})
+	command := ftpPI.comm
+	ftpPI.stateMutex.Lock()
+	ftpPI.transferDone = done
+	ftpPI.aborted = false
+	ftpPI.stateMutex.Unlock()
+	ftpPI.asyncCommand = true
+	go func() {
+		code := work()
+		ftpPI.metrics.Commands.Inc(command, fmt.Sprint(code))
+		ftpPI.endTransfer(done)
+	}()
+}
+
+// isAborted reports whether ABOR aborted the running transfer
+func (ftpPI *FtpPI) isAborted() bool {
+	ftpPI.stateMutex.Lock()
+	defer ftpPI.stateMutex.Unlock()
+	return ftpPI.aborted
+}
+
+// endTransfer marks the transfer done, it closes the session when the
+// server is draining and no command runs, or restarts the idle timeout
+func (ftpPI *FtpPI) endTransfer(done chan struct{}) {
+	ftpPI.stateMutex.Lock()
+	ftpPI.transferDone = nil
+	closing := ftpPI.draining && !ftpPI.busy
+	ftpPI.stateMutex.Unlock()
+	if closing {
+		ftpPI.closeDrained()
+	} else {
+		ftpPI.resetReadDeadline()
+	}
+	close(done)
+}
+
+// waitTransfer waits for the running transfer, aborting it first when
+// abort is set, and reports whether there was one
+func (ftpPI *FtpPI) waitTransfer(abort bool) bool {
+	ftpPI.stateMutex.Lock()
+	done := ftpPI.transferDone
+	if done != nil && abort {
+		ftpPI.aborted = true
+	}
+	ftpPI.stateMutex.Unlock()
+	if done == nil {
+		return false
+	}
+	if abort {
+		ftpPI.dtp.abort()
+	}
+	<-done
+	return true
+}
+
+// HandleABOR ...
+func (ftpPI *FtpPI) HandleABOR() error {
+	if !ftpPI.waitTransfer(true) {
+		ftpPI.writeMsg(225, "No transfer to abort.")
+		return nil
+	}
+	ftpPI.writeMsg(226, "Abort successful.")
+	return nil
+}
+
+// HandleNOOP ...
+func (ftpPI *FtpPI) HandleNOOP() error {
+	ftpPI.writeMsgCode(200)
+	return nil
+}
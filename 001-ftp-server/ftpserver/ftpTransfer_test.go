@@ -0,0 +1,81 @@
+package ftpserver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStripTelnet(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"ABOR\r\n", "ABOR\r\n"},
+		{"\xff\xf4\xff\xf2ABOR\r\n", "ABOR\r\n"},
+		{"\xff\xfb\x01ABOR\r\n", "ABOR\r\n"},
+		{"RETR a\xff\xffb\r\n", "RETR a\xffb\r\n"},
+		{"ABOR\xff", "ABOR"},
+	}
+	for _, test := range tests {
+		if got := stripTelnet(test.line); got != test.want {
+			t.Errorf("stripTelnet(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestABOR(t *testing.T) {
+	big := bytes.Repeat([]byte("0123456789abcdef"), 1<<20)
+	_, addr, cleanup := startTestServer(t, func(config *FtpConfig) {
+		ioutil.WriteFile(filepath.Join(config.RootDir, "big.bin"), big, 0666)
+	})
+	defer cleanup()
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.login()
+	client.cmd("ABOR", 225)
+
+	dataAddr := client.pasv()
+	client.cmd("RETR big.bin", 150)
+	data, err := net.Dial("tcp", dataAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer data.Close()
+	// the transfer blocks once the socket buffers are full as nothing reads
+	time.Sleep(100 * time.Millisecond)
+	client.conn.Write([]byte("\xff\xf4\xff\xf2ABOR\r\n"))
+	client.expect(426)
+	client.expect(226)
+	data.SetReadDeadline(time.Now().Add(5 * time.Second))
+	received, err := ioutil.ReadAll(data)
+	if err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			t.Fatalf("the data connection was not closed")
+		}
+	}
+	if len(received) >= len(big) {
+		t.Errorf("the whole file was sent despite ABOR")
+	}
+	if content := client.retr("hello.txt"); content != "hello\n" {
+		t.Errorf("RETR after ABOR got %q", content)
+	}
+}
+
+func TestCommandsDuringTransfer(t *testing.T) {
+	_, addr, cleanup := startTestServer(t, nil)
+	defer cleanup()
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.startRETR()
+	client.cmd("NOOP", 200)
+	client.cmd("PWD", 503)
+	client.cmd("PASV", 450)
+	client.cmd("RETR hello.txt", 450)
+	client.cmd("ABOR", 426)
+	client.expect(226)
+	client.cmd("PWD", 257)
+}
@@ -0,0 +1,208 @@
+package ftpserver
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OverwritePolicy tells what STOR does when the file exists
+type OverwritePolicy int
+
+const (
+	// OverwriteAllow replaces the file
+	OverwriteAllow OverwritePolicy = iota
+	// OverwriteDeny refuses the upload with 553
+	OverwriteDeny
+	// OverwriteRename stores the upload as name.1.ext, name.2.ext, ...
+	OverwriteRename
+	// OverwriteTimestamp stores the upload as name.YYYYMMDDHHMMSS.ext
+	OverwriteTimestamp
+)
+
+var overwritePolicyNames = []string{"allow", "deny", "rename", "timestamp"}
+
+func (policy OverwritePolicy) String() string {
+	if policy < OverwriteAllow || policy > OverwriteTimestamp {
+		return strconv.Itoa(int(policy))
+	}
+	return overwritePolicyNames[policy]
+}
+
+// ParseOverwritePolicy ...
+func ParseOverwritePolicy(s string) (OverwritePolicy, error) {
+	for i, name := range overwritePolicyNames {
+		if strings.EqualFold(s, name) {
+			return OverwritePolicy(i), nil
+		}
+	}
+	return OverwriteAllow, fmt.Errorf("unknown overwrite policy %q, expected one of %v", s, strings.Join(overwritePolicyNames, ", "))
+}
+
+// maxUniqueTries bounds the names tried for a renamed or STOU upload
+const maxUniqueTries = 1000
+
+// overwritePolicy returns the policy of the deepest configured directory
+// holding dir, or the default one
+func (settings *FtpServerSettings) overwritePolicy(dir string) OverwritePolicy {
+	policy, longest := settings.overwrite, -1
+	for prefix, dirPolicy := range settings.overwriteDirs {
+		if (dir == prefix || strings.HasPrefix(dir, prefix+"/")) && len(prefix) > longest {
+			policy, longest = dirPolicy, len(prefix)
+		}
+	}
+	return policy
+}
+
+// createNew creates a file which must not exist, atomically when the
+// storage implements ExclusiveCreator
+func (ftpDTP *FtpDTP) createNew(filePath string) (io.WriteCloser, error) {
+	if creator, ok := ftpDTP.storage.(ExclusiveCreator); ok {
+		return creator.CreateNew(filePath)
+	}
+	if _, err := ftpDTP.storage.Stat(filePath); err == nil {
+		return nil, &(os.PathError{Op: "create", Path: filePath, Err: os.ErrExist})
+	}
+	return ftpDTP.storage.Create(filePath)
+}
+
+// createUnique creates the first free name among filePath and the names
+// built by adding a suffix before its extension, it returns the path used
+func (ftpDTP *FtpDTP) createUnique(filePath string, suffix string) (string, io.WriteCloser, error) {
+	dir, name := path.Split(filePath)
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := filePath
+	for i := 0; i < maxUniqueTries; i++ {
+		switch {
+		case i > 0 && suffix == "":
+			candidate = fmt.Sprintf("%v%v.%v%v", dir, base, i, ext)
+		case i > 0:
+			candidate = fmt.Sprintf("%v%v.%v.%v%v", dir, base, suffix, i, ext)
+		case suffix != "":
+			candidate = fmt.Sprintf("%v%v.%v%v", dir, base, suffix, ext)
+		}
+		file, err := ftpDTP.createNew(candidate)
+		if err == nil || !os.IsExist(err) {
+			return candidate, file, err
+		}
+	}
+	return "", nil, fmt.Errorf("no free name for %v after %v tries", filePath, maxUniqueTries)
+}
+
+// createUpload creates the file of a STOR by the overwrite policy of its
+// directory and applies the umask, it returns the path used and whether
+// the file was reserved under a name which did not exist. A file which may
+// be overwritten is not opened, so that it is only truncated once the data
+// connection is open.
+func (ftpDTP *FtpDTP) createUpload(filePath string) (string, io.WriteCloser, bool, error) {
+	var file io.WriteCloser
+	var err error
+	policy := ftpDTP.settings.overwritePolicy(path.Dir(filePath))
+	switch policy {
+	case OverwriteDeny:
+		file, err = ftpDTP.createNew(filePath)
+	case OverwriteRename:
+		filePath, file, err = ftpDTP.createUnique(filePath, "")
+	case OverwriteTimestamp:
+		if _, statErr := ftpDTP.storage.Stat(filePath); statErr == nil {
+			filePath, file, err = ftpDTP.createUnique(filePath, time.Now().UTC().Format(timeFormat))
+		} else {
+			filePath, file, err = ftpDTP.createUnique(filePath, "")
+		}
+	default:
+		return filePath, nil, false, nil
+	}
+	if err != nil {
+		return "", nil, false, err
+	}
+	if err = ftpDTP.applyUmask(filePath); err != nil {
+		file.Close()
+		ftpDTP.discardUpload(filePath, true)
+		return "", nil, false, err
+	}
+	return filePath, file, true, nil
+}
+
+// openUpload creates or truncates the file of an upload which may
+// overwrite it and applies the umask
+func (ftpDTP *FtpDTP) openUpload(filePath string) (io.WriteCloser, error) {
+	file, err := ftpDTP.storage.Create(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if err = ftpDTP.applyUmask(filePath); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// discardUpload removes the empty file reserved for an upload which got no
+// data, the storage must implement Remover
+func (ftpDTP *FtpDTP) discardUpload(filePath string, reserved bool) {
+	if !reserved {
+		return
+	}
+	remover, ok := ftpDTP.storage.(Remover)
+	if !ok {
+		ftpDTP.logger.Warn("cannot remove the empty upload, the storage has no Remove", F("path", filePath))
+		return
+	}
+	if err := remover.Remove(filePath); err != nil {
+		ftpDTP.logger.Warn("cannot remove the empty upload", F("path", filePath), F("error", err))
+	}
+}
+
+// replyCreateError replies 553 when the file exists and 451 otherwise
+func (ftpPI *FtpPI) replyCreateError(err error) {
+	if os.IsExist(err) {
+		ftpPI.writeMsg(553, "File exists, overwriting is not allowed.")
+	} else {
+		ftpPI.writeMsg(451, "Cannot create the file.")
+	}
+}
+
+// uploadName is the name of the stored file as the client asked for it,
+// the directory part of arg followed by the name used
+func uploadName(arg string, filePath string) string {
+	if idx := strings.LastIndex(arg, "/"); idx >= 0 {
+		return arg[:idx+1] + path.Base(filePath)
+	}
+	return path.Base(filePath)
+}
+
+// HandleSTOU stores a file under a name which does not exist yet, built
+// from the argument when given, and replies "150 FILE: <name>"
+func (ftpPI *FtpPI) HandleSTOU() error {
+	arg := ftpPI.para
+	if arg == "" {
+		arg = "stou." + time.Now().UTC().Format(timeFormat)
+	}
+	filePath := ftpPI.resolvePath(arg)
+	dir := path.Dir(filePath)
+	if strings.HasSuffix(arg, "/") || !ftpPI.dtp.ValidPath(dir) || !ftpPI.dtp.IsDir(dir) {
+		ftpPI.writeMsgCode(450)
+		return fmt.Errorf("invalid path %v", filePath)
+	}
+	filePath, file, err := ftpPI.dtp.createUnique(filePath, "")
+	if err == nil {
+		if err = ftpPI.dtp.applyUmask(filePath); err != nil {
+			file.Close()
+			ftpPI.dtp.discardUpload(filePath, true)
+		}
+	}
+	if err != nil {
+		ftpPI.replyCreateError(err)
+		return err
+	}
+	ftpPI.writeMsg(150, "FILE: "+uploadName(arg, filePath))
+	ftpPI.runTransfer(func() error {
+		return ftpPI.dtp.receiveTo(filePath, file, true)
+	})
+	return nil
+}
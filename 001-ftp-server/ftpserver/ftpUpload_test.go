@@ -0,0 +1,194 @@
+package ftpserver
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+)
+
+func TestParseOverwritePolicy(t *testing.T) {
+	tests := []struct {
+		value  string
+		policy OverwritePolicy
+		err    bool
+	}{
+		{"allow", OverwriteAllow, false},
+		{"deny", OverwriteDeny, false},
+		{"Rename", OverwriteRename, false},
+		{"TIMESTAMP", OverwriteTimestamp, false},
+		{"overwrite", OverwriteAllow, true},
+		{"", OverwriteAllow, true},
+	}
+	for _, test := range tests {
+		policy, err := ParseOverwritePolicy(test.value)
+		if (err != nil) != test.err || policy != test.policy {
+			t.Errorf("ParseOverwritePolicy(%q) = %v, %v, want %v, error %v", test.value, policy, err, test.policy, test.err)
+		}
+	}
+}
+
+func TestUploadName(t *testing.T) {
+	tests := []struct {
+		arg      string
+		filePath string
+		want     string
+	}{
+		{"a.txt", "/srv/ftp/ABC/a.1.txt", "a.1.txt"},
+		{"/ABC/a.txt", "/srv/ftp/ABC/a.1.txt", "/ABC/a.1.txt"},
+		{"in/a.txt", "/srv/ftp/ABC/in/a.20200102030405.txt", "in/a.20200102030405.txt"},
+	}
+	for _, test := range tests {
+		if got := uploadName(test.arg, test.filePath); got != test.want {
+			t.Errorf("uploadName(%q, %q) = %q, want %q", test.arg, test.filePath, got, test.want)
+		}
+	}
+}
+
+// dirFiles returns the names and contents of the files in dir
+func dirFiles(t *testing.T, dir string) map[string]string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, info := range infos {
+		if !info.IsDir() {
+			data, _ := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+			files[info.Name()] = string(data)
+		}
+	}
+	return files
+}
+
+func TestOverwritePolicy(t *testing.T) {
+	var rootDir string
+	_, addr, cleanup := startTestServer(t, func(config *FtpConfig) {
+		rootDir = config.RootDir
+		config.Upload.Overwrite = "deny"
+		config.Upload.OverwriteDirs = []string{"/in=rename", "/in/keep=allow", "/log = timestamp"}
+	})
+	defer cleanup()
+	for _, dir := range []string{"in", "in/keep", "log"} {
+		os.Mkdir(filepath.Join(rootDir, dir), 0777)
+	}
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.login()
+
+	client.pasv()
+	client.cmd("STOR hello.txt", 553)
+	client.stor("new.txt", "new")
+	client.stor("/in/a.txt", "one")
+	client.stor("/in/a.txt", "two")
+	client.stor("/in/a.txt", "three")
+	client.stor("/in/keep/a.txt", "one")
+	client.stor("/in/keep/a.txt", "two")
+	client.stor("/log/a.log", "one")
+	client.stor("/log/a.log", "two")
+
+	if data, _ := ioutil.ReadFile(filepath.Join(rootDir, "hello.txt")); string(data) != "hello\n" {
+		t.Errorf("STOR with deny changed hello.txt to %q", data)
+	}
+	if files := dirFiles(t, filepath.Join(rootDir, "in")); len(files) != 3 ||
+		files["a.txt"] != "one" || files["a.1.txt"] != "two" || files["a.2.txt"] != "three" {
+		t.Errorf("STOR with rename wrote %q", files)
+	}
+	if files := dirFiles(t, filepath.Join(rootDir, "in/keep")); len(files) != 1 || files["a.txt"] != "two" {
+		t.Errorf("STOR with allow wrote %q", files)
+	}
+	files := dirFiles(t, filepath.Join(rootDir, "log"))
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[1] != "a.log" || !regexp.MustCompile(`^a\.\d{14}\.log$`).MatchString(names[0]) ||
+		files["a.log"] != "one" || files[names[0]] != "two" {
+		t.Errorf("STOR with timestamp wrote %q", files)
+	}
+}
+
+func TestSTOU(t *testing.T) {
+	var rootDir string
+	_, addr, cleanup := startTestServer(t, func(config *FtpConfig) {
+		rootDir = config.RootDir
+	})
+	defer cleanup()
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.login()
+
+	stou := func(command string, want string) {
+		dataAddr := client.pasv()
+		if reply := client.cmd(command, 150); !regexp.MustCompile(`^150 FILE: ` + want + `$`).MatchString(reply) {
+			t.Errorf("%v = %q, want FILE: %v", command, reply, want)
+		}
+		data, err := net.Dial("tcp", dataAddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(data, command)
+		data.Close()
+		client.expect(226)
+	}
+	stou("STOU hello.txt", `hello\.1\.txt`)
+	stou("STOU /hello.txt", `/hello\.2\.txt`)
+	stou("STOU", `stou\.\d{14}`)
+	client.cmd("STOU /missing/a.txt", 450)
+	client.cmd("STOU /", 450)
+
+	files := dirFiles(t, rootDir)
+	if files["hello.txt"] != "hello\n" || files["hello.1.txt"] != "STOU hello.txt" || files["hello.2.txt"] != "STOU /hello.txt" || len(files) != 4 {
+		t.Errorf("STOU wrote %q", files)
+	}
+}
+
+func TestUploadAborted(t *testing.T) {
+	var rootDir string
+	_, addr, cleanup := startTestServer(t, func(config *FtpConfig) {
+		rootDir = config.RootDir
+		config.Upload.Overwrite = "rename"
+	})
+	defer cleanup()
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.login()
+
+	// the names reserved by STOR and STOU are freed when no data arrives
+	for _, command := range []string{"STOR hello.txt", "STOU hello.txt", "STOR new.txt"} {
+		client.pasv()
+		client.cmd(command, 150)
+		client.cmd("ABOR", 426)
+		client.expect(226)
+	}
+	if files := dirFiles(t, rootDir); len(files) != 1 || files["hello.txt"] != "hello\n" {
+		t.Errorf("aborted uploads left %q", files)
+	}
+}
+
+func TestSTOROverwrite(t *testing.T) {
+	var rootDir string
+	_, addr, cleanup := startTestServer(t, func(config *FtpConfig) {
+		rootDir = config.RootDir
+	})
+	defer cleanup()
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.login()
+
+	// the file is only truncated once the data connection is open
+	client.cmd("STOR hello.txt", 150)
+	client.expect(425)
+	if data, _ := ioutil.ReadFile(filepath.Join(rootDir, "hello.txt")); string(data) != "hello\n" {
+		t.Errorf("STOR without a data connection changed hello.txt to %q", data)
+	}
+	client.stor("hello.txt", "hi")
+	if data, _ := ioutil.ReadFile(filepath.Join(rootDir, "hello.txt")); string(data) != "hi" {
+		t.Errorf("STOR of a shorter file left %q", data)
+	}
+}
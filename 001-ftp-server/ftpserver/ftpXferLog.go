@@ -0,0 +1,88 @@
+package ftpserver
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// XferEntry describes a finished or aborted RETR or STOR
+type XferEntry struct {
+	End        time.Time
+	Duration   time.Duration
+	RemoteHost string
+	Bytes      int64
+	Filename   string
+	Binary     bool
+	Incoming   bool
+	User       string
+	Complete   bool
+}
+
+// FtpXferLog writes transfers in the wu-ftpd xferlog format read by the
+// usual log analyzers, a nil FtpXferLog logs nothing.
+type FtpXferLog struct {
+	file *RotatingFile
+}
+
+// CreateFtpXferLog opens filename for appending and rotates it with rotate
+func CreateFtpXferLog(filename string, rotate RotateOptions) (*FtpXferLog, error) {
+	file, err := OpenRotatingFile(filename, rotate)
+	if err != nil {
+		return nil, err
+	}
+	return &(FtpXferLog{file}), nil
+}
+
+// Log writes one line:
+// current-time transfer-time remote-host file-size filename transfer-type
+// special-action-flag direction access-mode username service-name
+// authentication-method authenticated-user-id completion-status
+func (xferLog *FtpXferLog) Log(entry XferEntry) {
+	if xferLog == nil {
+		return
+	}
+	transferType := "a"
+	if entry.Binary {
+		transferType = "b"
+	}
+	direction := "o"
+	if entry.Incoming {
+		direction = "i"
+	}
+	status := "i"
+	if entry.Complete {
+		status = "c"
+	}
+	seconds := int64((entry.Duration + time.Second/2) / time.Second)
+	line := fmt.Sprintf("%v %v %v %v %v %v _ %v r %v ftp 0 * %v\n",
+		entry.End.Format("Mon Jan _2 15:04:05 2006"), seconds, entry.RemoteHost, entry.Bytes,
+		xferField(entry.Filename), transferType, direction, xferField(entry.User), status)
+	xferLog.file.Write([]byte(line))
+}
+
+// xferField replaces white space which would shift the following fields
+func xferField(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// Reopen reopens the log file after it was moved by an external tool
+func (xferLog *FtpXferLog) Reopen() error {
+	if xferLog == nil {
+		return nil
+	}
+	return xferLog.file.Reopen()
+}
+
+// Close ...
+func (xferLog *FtpXferLog) Close() error {
+	if xferLog == nil {
+		return nil
+	}
+	return xferLog.file.Close()
+}
@@ -0,0 +1,56 @@
+package ftpserver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestXferLogLine(t *testing.T) {
+	name := writeTempFile(t, "")
+	defer os.Remove(name)
+	xferLog, err := CreateFtpXferLog(name, RotateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	end := time.Date(2024, time.March, 5, 14, 2, 9, 0, time.UTC)
+	xferLog.Log(XferEntry{End: end, Duration: 1600 * time.Millisecond, RemoteHost: "192.0.2.7", Bytes: 1024,
+		Filename: "/srv/my file.txt", Binary: true, Incoming: false, User: "ABC", Complete: true})
+	xferLog.Log(XferEntry{End: end, Duration: 0, RemoteHost: "192.0.2.7", Bytes: 10,
+		Filename: "/srv/up.txt", Binary: false, Incoming: true, User: "ABC", Complete: false})
+	xferLog.Close()
+	var nilLog *FtpXferLog
+	nilLog.Log(XferEntry{})
+	nilLog.Close()
+
+	data, _ := ioutil.ReadFile(name)
+	want := "Tue Mar  5 14:02:09 2024 2 192.0.2.7 1024 /srv/my_file.txt b _ o r ABC ftp 0 * c\n" +
+		"Tue Mar  5 14:02:09 2024 0 192.0.2.7 10 /srv/up.txt a _ i r ABC ftp 0 * i\n"
+	if string(data) != want {
+		t.Errorf("got\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestXferLogRETR(t *testing.T) {
+	var xferLogFile string
+	_, addr, cleanup := startTestServer(t, func(config *FtpConfig) {
+		xferLogFile = filepath.Join(filepath.Dir(config.RootDir), "xferlog")
+		config.XferLog.File = xferLogFile
+	})
+	defer cleanup()
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	client.login()
+	client.cmd("TYPE A", 200)
+	if content := client.retr("hello.txt"); content != "hello\n" {
+		t.Fatalf("RETR got %q", content)
+	}
+	data, _ := ioutil.ReadFile(xferLogFile)
+	line := regexp.MustCompile(`^\w{3} \w{3} [ \d]\d \d\d:\d\d:\d\d \d{4} \d+ 127\.0\.0\.1 6 \S+/hello\.txt a _ o r ABC ftp 0 \* c\n$`)
+	if !line.Match(data) {
+		t.Errorf("xferlog = %q", data)
+	}
+}
@@ -1,56 +1,208 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
-)
+	"strconv"
+	"time"
 
-const (
-	minPort = 2121
-	maxPort = 2200
+	"myftp/ftpserver"
 )
 
+// flagKeys maps command line flags to the configuration keys they override
+var flagKeys = map[string]string{
+	"d":                  "root_dir",
+	"idle-timeout":       "limits.idle_timeout",
+	"login-timeout":      "limits.login_timeout",
+	"transfer-timeout":   "limits.transfer_timeout",
+	"max-login-attempts": "limits.max_login_attempts",
+	"login-fail-delay":   "limits.login_fail_delay",
+	"ban-failures":       "limits.ban_failures",
+	"ban-duration":       "limits.ban_duration",
+	"shutdown-grace":     "limits.shutdown_grace",
+	"pasv-timeout":       "passive.timeout",
+	"pasv-min-port":      "passive.min_port",
+	"pasv-max-port":      "passive.max_port",
+	"pasv-addr":          "passive.address",
+	"pasv-addr-map":      "passive.address_map",
+	"proxy-protocol":     "proxy.enabled",
+	"proxy-trusted":      "proxy.trusted",
+	"admin":              "admin.listen",
+	"metrics":            "metrics.listen",
+	"health":             "health.listen",
+	"log-file":           "log.file",
+	"log-format":         "log.format",
+	"log-level":          "log.level",
+	"xferlog":            "xferlog.file",
+	"overwrite":          "upload.overwrite",
+	"webhook":            "hooks.webhooks",
+	"hook-command":       "hooks.command",
+}
+
 func main() {
-	portV := flag.Int("p", 2121, "listening port")
-	hostV := flag.String("a", "", "binding address")
-	dirV := flag.String("d", RootDir, "change current directory")
-	nativeV := flag.Int("native", 0, "run in native system")
+	config := ftpserver.DefaultFtpConfig()
+	configV := flag.String("c", os.Getenv("MYFTP_CONFIG"), "configuration file (TOML), defaults to $MYFTP_CONFIG")
+	portV := flag.Int("p", 2121, "listening port, replaces listen.addresses")
+	hostV := flag.String("a", "", "binding address, replaces listen.addresses")
+	flag.String("d", config.RootDir, "change current directory")
+	nativeV := flag.Int("native", 0, "run in native system, with files in the current directory")
+	flag.Duration("idle-timeout", config.Limits.IdleTimeout, "close idle control connections after this duration, 0 to disable")
+	flag.Duration("login-timeout", config.Limits.LoginTimeout, "close connections not logged in after this duration, 0 to disable")
+	flag.Duration("pasv-timeout", config.Passive.Timeout, "wait this long for the client to open a passive data connection, 0 to disable")
+	flag.Duration("transfer-timeout", config.Limits.TransferTimeout, "abort transfers stalled for this duration, 0 to disable")
+	flag.Int("max-login-attempts", config.Limits.MaxLoginAttempts, "disconnect a session after this many failed logins, 0 for no limit")
+	flag.Duration("login-fail-delay", config.Limits.LoginFailDelay, "delay a failed login by this duration times the failures of the session")
+	flag.Int("ban-failures", config.Limits.BanFailures, "ban an IP after this many failed logins across sessions, 0 to disable")
+	flag.Duration("ban-duration", config.Limits.BanDuration, "how long an IP stays banned")
+	flag.Int("pasv-min-port", config.Passive.MinPort, "lowest passive data port")
+	flag.Int("pasv-max-port", config.Passive.MaxPort, "highest passive data port")
+	flag.String("pasv-addr", "", "IPv4 address or host name (resolved at startup) advertised in PASV replies")
+	flag.String("pasv-addr-map", "", "advertised PASV address per listening address, e.g. 10.0.0.5=203.0.113.7,10.0.0.6=ftp.example.com")
+	flag.Bool("proxy-protocol", false, "read PROXY protocol v1/v2 headers on connections from trusted upstreams")
+	flag.String("proxy-trusted", "", "comma separated CIDRs of load balancers allowed to send PROXY headers")
+	flag.Duration("shutdown-grace", config.Limits.ShutdownGrace, "on SIGINT or SIGTERM, let running transfers finish for this long")
+	flag.String("admin", "", "listen address of the admin HTTP API, e.g. 127.0.0.1:2280, empty to disable")
+	flag.String("metrics", "", "listen address of the Prometheus /metrics endpoint, e.g. :9121, empty to disable")
+	flag.String("health", "", "listen address of the /healthz and /readyz endpoints, may be the metrics address, empty to disable")
+	flag.String("log-file", config.Log.File, "log file, or stdout or stderr")
+	flag.String("log-format", config.Log.Format, "log format, text or json")
+	flag.String("log-level", config.Log.Level, "log level, debug, info, warn or error")
+	flag.String("xferlog", config.XferLog.File, "transfer log file in the xferlog format, empty to disable")
+	flag.String("overwrite", config.Upload.Overwrite, "what STOR does with an existing file: allow, deny, rename or timestamp")
+	flag.String("webhook", "", "comma separated URLs receiving login, logout and transfer events as JSON")
+	flag.String("hook-command", "", "path of a program run for every event, with the JSON on its standard input")
 
 	flag.Parse()
 
-	RootDir = *dirV
-	if *portV < minPort || *portV > maxPort {
-		fmt.Printf("Required port number in [%v, %v]\n", minPort, maxPort)
+	err := loadConfig(config, *configV, *nativeV == 1)
+	if err == nil && (isFlagSet("p") || isFlagSet("a")) {
+		config.Listen.Addresses = []string{net.JoinHostPort(*hostV, strconv.Itoa(*portV))}
+	}
+	if err == nil {
+		flag.Visit(func(f *flag.Flag) {
+			if key, ok := flagKeys[f.Name]; ok && err == nil {
+				err = config.Set(key, f.Value.String())
+				if err != nil {
+					err = fmt.Errorf("-%v: %v", f.Name, err)
+				}
+			}
+		})
+	}
+	if err != nil {
+		fmt.Println("Cannot load configuration:", err)
 		os.Exit(1)
 	}
-	fmt.Printf("Port: %v, Host: %v, Directory: %v\n", *portV, *hostV, *dirV)
+	fmt.Printf("Listen: %v, Directory: %v\n", config.Listen.Addresses, config.RootDir)
 
-	if *nativeV == 1 {
-		RootDir = "./ftpdir"
-		AccountFile = "./ftpAccounts.dat"
-		logFile = "./MyFtpLog.log"
+	server, err := ftpserver.CreateFtpServer(config)
+	if err != nil {
+		fmt.Println("Cannot create server:", err)
+		os.Exit(1)
 	}
+	stopped := make(chan struct{})
+	go handleSignal(server, config.Limits.ShutdownGrace, stopped)
 
-	go handleSignal()
-
-	server, err := CreateFtpServer(*hostV, *portV)
+	if config.Admin.Listen != "" {
+		go func() {
+			err := ftpserver.CreateFtpAdmin(config.Admin.Listen, config.Admin.Token, server).ListenAndServe()
+			fmt.Println("Admin API stopped:", err)
+		}()
+	}
+	serveStatus(server, config)
+	err = server.ListenAndServe()
 	if err != nil {
-		fmt.Println("Cannot create server!")
+		fmt.Println("Server stopped:", err)
+		os.Exit(1)
 	}
-	server.Listen()
-	server.Serve()
+	<-stopped
 }
 
-func handleSignal() {
+// serveStatus serves the metrics and health endpoints, on one listener
+// when they share an address
+func serveStatus(server *ftpserver.FtpServer, config *ftpserver.FtpConfig) {
+	muxes := make(map[string]*http.ServeMux)
+	mux := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+	if config.Metrics.Listen != "" {
+		mux(config.Metrics.Listen).Handle("/metrics", server.Metrics())
+	}
+	if config.Health.Listen != "" {
+		health := server.HealthHandler()
+		mux(config.Health.Listen).Handle("/healthz", health)
+		mux(config.Health.Listen).Handle("/readyz", health)
+	}
+	for addr, m := range muxes {
+		go func(addr string, m *http.ServeMux) {
+			err := http.ListenAndServe(addr, m)
+			fmt.Println("Status listener stopped:", err)
+		}(addr, m)
+	}
+}
+
+// loadConfig applies the native paths, then the configuration file, then
+// the environment, command line flags are applied afterwards.
+func loadConfig(config *ftpserver.FtpConfig, filename string, native bool) error {
+	if native {
+		config.RootDir = "./ftpdir"
+		config.AccountFile = "./ftpAccounts.dat"
+		config.AccessFile = "./ftpAccess.dat"
+		config.Log.File = "./MyFtpLog.log"
+	}
+	if filename != "" {
+		err := config.LoadFile(filename)
+		if err != nil {
+			return err
+		}
+	}
+	return config.LoadEnv()
+}
+
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// handleSignal shuts the server down gracefully on one of shutdownSignals
+// and closes stopped when done, the other signals of the platform are
+// passed to handleOtherSignal.
+func handleSignal(server *ftpserver.FtpServer, grace time.Duration, stopped chan struct{}) {
 	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, os.Interrupt)
+	signal.Notify(ch, append(shutdownSignals, otherSignals...)...)
 	for {
-		switch s := <-ch; s {
-		case os.Interrupt:
-			fmt.Println("SIGTERM Signal!")
-			os.Exit(0)
+		s := <-ch
+		if isShutdownSignal(s) {
+			fmt.Printf("%v Signal, shutting down within %v.\n", s, grace)
+			signal.Reset(shutdownSignals...)
+			ctx, cancel := context.WithTimeout(context.Background(), grace)
+			err := server.Shutdown(ctx)
+			cancel()
+			if err != nil {
+				fmt.Println("Shutdown grace period expired, transfers were aborted.")
+			}
+			close(stopped)
+			return
+		}
+		handleOtherSignal(server, s)
+	}
+}
+
+func isShutdownSignal(s os.Signal) bool {
+	for _, shutdown := range shutdownSignals {
+		if s == shutdown {
+			return true
 		}
 	}
+	return false
 }
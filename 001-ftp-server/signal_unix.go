@@ -0,0 +1,34 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"myftp/ftpserver"
+)
+
+// shutdownSignals stop the server, otherSignals are handled by
+// handleOtherSignal
+var (
+	shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	otherSignals    = []os.Signal{syscall.SIGHUP, syscall.SIGUSR1}
+)
+
+// handleOtherSignal reloads the access rules on SIGHUP and reopens the log
+// files on SIGUSR1
+func handleOtherSignal(server *ftpserver.FtpServer, s os.Signal) {
+	switch s {
+	case syscall.SIGHUP:
+		fmt.Println("SIGHUP Signal, reloading access rules.")
+		server.Reload()
+	case syscall.SIGUSR1:
+		err := server.ReopenLogs()
+		if err != nil {
+			fmt.Println("Cannot reopen log files:", err)
+		}
+	}
+}
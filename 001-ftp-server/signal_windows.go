@@ -0,0 +1,19 @@
+package main
+
+import (
+	"os"
+	"syscall"
+
+	"myftp/ftpserver"
+)
+
+// shutdownSignals stop the server, Windows has no SIGHUP or SIGUSR1: the
+// access rules are reloaded through the admin API and the log files rely on
+// the built-in rotation
+var (
+	shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	otherSignals    []os.Signal
+)
+
+func handleOtherSignal(server *ftpserver.FtpServer, s os.Signal) {
+}